@@ -0,0 +1,151 @@
+// Command analyze summarizes the outputs of a testground run of the qri test
+// plan: per-role outcomes, transfer duration percentiles, per-remote
+// breakdowns, assertions & every other recorded metric.
+//
+//	analyze [-json] [-messages] <outputs dir>
+//
+// The outputs directory is either the OutputsPath of a local run or an
+// extracted `testground collect` archive. With -compare, analyze lines up the
+// metrics of two runs & exits with status 3 if any -threshold is crossed:
+//
+//	analyze -compare [-json] [-threshold metric[,key=value...][@role]:stat:±percent]... <before dir> <after dir>
+//
+// -timeline writes an HTML page with a swimlane per instance, showing when it
+// signalled each sync state & how long it waited on each barrier
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/qri-io/test-plans/results"
+)
+
+// exitThresholdCrossed is the exit status of a comparison that crossed a
+// threshold
+const exitThresholdCrossed = 3
+
+// thresholdsFlag collects repeated -threshold flags
+type thresholdsFlag []results.Threshold
+
+func (f *thresholdsFlag) String() string {
+	strs := make([]string, len(*f))
+	for i, t := range *f {
+		strs[i] = t.String()
+	}
+	return strings.Join(strs, ", ")
+}
+
+func (f *thresholdsFlag) Set(s string) error {
+	t, err := results.ParseThreshold(s)
+	if err != nil {
+		return err
+	}
+	*f = append(*f, t)
+	return nil
+}
+
+func main() {
+	var thresholds thresholdsFlag
+	asJSON := flag.Bool("json", false, "write the summary as JSON")
+	messages := flag.Bool("messages", false, "also write every message each instance recorded")
+	compare := flag.Bool("compare", false, "compare the metrics of two runs")
+	timeline := flag.String("timeline", "", "also write an HTML timeline of the run's sync states to this file")
+	flag.Var(&thresholds, "threshold", "with -compare, the largest allowed change to a metric, as metric[,key=value...][@role]:stat:±percent. may be repeated")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags] <outputs dir>\n       %s -compare [flags] <before dir> <after dir>\n", os.Args[0], os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if *compare {
+		if flag.NArg() != 2 {
+			flag.Usage()
+			os.Exit(2)
+		}
+		crossed, err := compareRuns(flag.Arg(0), flag.Arg(1), thresholds, *asJSON)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		if crossed {
+			os.Exit(exitThresholdCrossed)
+		}
+		return
+	}
+
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err := analyze(flag.Arg(0), *asJSON, *messages, *timeline); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func analyze(dir string, asJSON, messages bool, timeline string) error {
+	run, err := results.ReadRun(dir)
+	if err != nil {
+		return err
+	}
+	if timeline != "" {
+		if err := writeTimeline(run, timeline); err != nil {
+			return err
+		}
+	}
+	summary := results.Summarize(run)
+
+	if asJSON {
+		return writeJSON(summary)
+	}
+	if err := results.WriteText(os.Stdout, summary); err != nil {
+		return err
+	}
+	if messages {
+		return results.WriteMessages(os.Stdout, run)
+	}
+	return nil
+}
+
+func writeTimeline(run *results.Run, path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := results.WriteTimelineHTML(f, run); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// compareRuns writes the comparison of two runs, returning true if any
+// threshold was crossed
+func compareRuns(beforeDir, afterDir string, thresholds []results.Threshold, asJSON bool) (bool, error) {
+	before, err := results.ReadRun(beforeDir)
+	if err != nil {
+		return false, err
+	}
+	after, err := results.ReadRun(afterDir)
+	if err != nil {
+		return false, err
+	}
+	c := results.Compare(results.Summarize(before), results.Summarize(after), thresholds)
+
+	if asJSON {
+		err = writeJSON(c)
+	} else {
+		err = results.WriteComparisonText(os.Stdout, c)
+	}
+	return len(c.Violations) > 0, err
+}
+
+func writeJSON(v interface{}) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
@@ -3,6 +3,8 @@ module github.com/qri-io/test-plans
 go 1.14
 
 require (
+	github.com/BurntSushi/toml v0.3.1
+	github.com/ipfs/go-cid v0.0.6
 	github.com/libp2p/go-libp2p-core v0.5.7
 	github.com/libp2p/go-libp2p-peer v0.2.0
 	github.com/qri-io/dataset v0.2.0
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/qri-io/qri/dsref"
+	"github.com/qri-io/test-plans/plan"
+	"github.com/qri-io/test-plans/sim"
+	"github.com/testground/sdk-go/sync"
+)
+
+const (
+	roleClient = "client"
+	// defaultHookPushTimeout is how long clients wait on each push unless
+	// hook_push_timeout_secs is set
+	defaultHookPushTimeout = 30 * time.Second
+)
+
+var stateFaultTransfers = sync.State("faulted transfers attempted")
+
+// hookFaultReport lists the requests a remote's hooks rejected
+type hookFaultReport struct {
+	Peername string
+	Faults   []sim.InjectedFault
+}
+
+var hookFaultReportTopic = sync.NewTopic("hook-fault-report", &hookFaultReport{})
+
+// RunPlanHookFaults has remotes inject failures into qri's remote protocol
+// through their hooks, configured by the hook_* params:
+//   - clients push a dataset to, then pull a dataset from every remote
+//   - remotes report every request their hooks rejected
+//   - clients assert each rejected request failed, each accepted request
+//     succeeded, & rejected pulls left no ref behind
+//   - remotes assert rejected pushes left no ref behind
+//
+// remotes are reached over p2p, where qri hangs up on rejected requests
+// without sending the hook's error, so failures can't be matched to the
+// injected fault by their error text. qri also transfers logs before
+// datasets, so a dataset rejected by acceptPushPreCheck or datasetPulled
+// still leaves its log behind. a client whose push is rejected never gets a
+// reply & qri gives it no context to cancel, so clients stop waiting on each
+// push after hook_push_timeout_secs & count it as failed
+func RunPlanHookFaults(ctx context.Context, p *plan.Plan) error {
+	if err := p.AssignRoles(
+		plan.Role{Name: roleClient, Weight: getPushersPerReceiver(p)},
+		plan.Role{Name: roleRemote, Weight: 1},
+	); err != nil {
+		return err
+	}
+	if err := p.SetupNetwork(ctx); err != nil {
+		return err
+	}
+	isRemote := p.Role() == roleRemote
+
+	constructor := newFaultClient
+	if isRemote {
+		constructor = newRemote
+	}
+	if err := p.ConstructActor(ctx, constructor); err != nil {
+		return err
+	}
+
+	// Share this node's info w/ all nodes on the network
+	if err := p.ShareInfo(ctx); err != nil {
+		return err
+	}
+
+	executeActions := faultClientActions
+	if isRemote {
+		executeActions = faultRemoteActions
+	}
+	if err := executeActions(ctx, p); err != nil {
+		p.Runenv.RecordFailure(err)
+	}
+	p.ActorFinished(ctx)
+	return p.Outcome(ctx)
+}
+
+func newFaultClient(ctx context.Context, p *plan.Plan) (*sim.Actor, error) {
+	act, err := sim.NewActor(ctx, p.Runenv, p.Client, p.Seq)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := generateDatasetHistory(ctx, p, act, datasetName); err != nil {
+		return nil, err
+	}
+
+	if err := act.Inst.Connect(ctx); err != nil {
+		return nil, err
+	}
+
+	if err := p.ReceiveRemoteInfo(ctx, act, p.Roles.Count(roleRemote)); err != nil {
+		return nil, err
+	}
+
+	p.Runenv.RecordMessage("I'm a Client named %s", act.Peername())
+	p.Runenv.RecordMessage("My qri ID is %s", act.ID())
+	p.Runenv.RecordMessage("My peer ID is %s", act.AddrInfo().ID)
+	return act, nil
+}
+
+// faultClientActions pushes to & pulls from each remote, then checks the
+// outcome of each request against the faults remotes injected
+func faultClientActions(ctx context.Context, p *plan.Plan) error {
+	pushErrs := map[string]error{}
+	pullErrs := map[string]error{}
+	timeout := getHookPushTimeout(p)
+	for remoteName := range *p.Actor.Inst.Config().Remotes {
+		pushErrs[remoteName] = pushWithin(ctx, p, remoteName, timeout)
+		pullErrs[remoteName] = p.PullFromRemote(ctx, remoteName, pullDatasetName)
+	}
+	p.Client.MustSignalEntry(ctx, stateFaultTransfers)
+
+	reports, err := receiveFaultReports(ctx, p)
+	if err != nil {
+		return err
+	}
+
+	id := p.Actor.ID()
+	for _, rep := range reports {
+		pushRejected := hasFault(rep, id, sim.HookAcceptPushPreCheck, sim.HookLogPushFinalCheck)
+		pullRejected := hasFault(rep, id, sim.HookDatasetPulled)
+		p.Assert("push_fault_surfaced", checkFaultSurfaced(pushErrs[rep.Peername], pushRejected))
+		p.Assert("pull_fault_surfaced", checkFaultSurfaced(pullErrs[rep.Peername], pullRejected))
+		if pullRejected {
+			p.Assert("pull_no_partial_state", checkNoRef(p, dsref.Ref{Username: rep.Peername, Name: pullDatasetName}))
+		}
+	}
+	return nil
+}
+
+// pushWithin pushes to remoteName, failing once timeout elapses. the push
+// keeps running in the background, qri doesn't let it be cancelled, so the
+// attempt is signalled here rather than whenever the push returns
+func pushWithin(ctx context.Context, p *plan.Plan, remoteName string, timeout time.Duration) error {
+	pushed := make(chan error, 1)
+	go func() {
+		pushed <- p.Push(ctx, remoteName, datasetName)
+	}()
+
+	var err error
+	select {
+	case err = <-pushed:
+	case <-time.After(timeout):
+		err = fmt.Errorf("push to %s didn't finish within %s", remoteName, timeout)
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	if sigErr := p.SignalPushSent(ctx); sigErr != nil {
+		return plan.AccumulateErrors(err, sigErr)
+	}
+	return err
+}
+
+func getHookPushTimeout(p *plan.Plan) time.Duration {
+	if !p.Runenv.IsParamSet("hook_push_timeout_secs") {
+		return defaultHookPushTimeout
+	}
+	if secs := p.Runenv.IntParam("hook_push_timeout_secs"); secs > 0 {
+		return time.Duration(secs) * time.Second
+	}
+	return defaultHookPushTimeout
+}
+
+// faultRemoteActions waits for clients to finish their requests, reports the
+// faults its hooks injected & checks rejected pushes left no ref behind
+func faultRemoteActions(ctx context.Context, p *plan.Plan) error {
+	<-p.Client.MustBarrier(ctx, stateFaultTransfers, p.Roles.Count(roleClient)).C
+
+	faults := p.Actor.Hooks().Injected()
+	p.Runenv.RecordMessage("hooks injected %d faults", len(faults))
+	if _, err := p.Client.Publish(ctx, hookFaultReportTopic, &hookFaultReport{
+		Peername: p.Actor.Peername(),
+		Faults:   faults,
+	}); err != nil {
+		return fmt.Errorf("publishing hook fault report: %w", err)
+	}
+
+	for _, f := range faults {
+		if f.Hook == sim.HookAcceptPushPreCheck || f.Hook == sim.HookLogPushFinalCheck {
+			ref := dsref.Ref{Username: f.Ref.Username, Name: f.Ref.Name}
+			p.Assert("push_no_partial_state", checkNoRef(p, ref))
+		}
+	}
+	return nil
+}
+
+func receiveFaultReports(ctx context.Context, p *plan.Plan) ([]*hookFaultReport, error) {
+	ch := make(chan *hookFaultReport)
+	sub, err := p.Client.Subscribe(ctx, hookFaultReportTopic, ch)
+	if err != nil {
+		return nil, fmt.Errorf("hook fault report subscription failure: %w", err)
+	}
+	numRemotes := p.Roles.Count(roleRemote)
+	reports := make([]*hookFaultReport, 0, numRemotes)
+	for len(reports) < numRemotes {
+		select {
+		case rep := <-ch:
+			reports = append(reports, rep)
+		case err := <-sub.Done():
+			return nil, err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	return reports, nil
+}
+
+// hasFault reports whether any of the given hooks rejected a request from the
+// profile with ID id
+func hasFault(rep *hookFaultReport, id string, hooks ...string) bool {
+	for _, f := range rep.Faults {
+		if f.ProfileID != id {
+			continue
+		}
+		for _, h := range hooks {
+			if f.Hook == h {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// checkFaultSurfaced confirms a request failed if a remote rejected it, &
+// succeeded otherwise. over p2p the error doesn't say why the remote hung up,
+// so any error counts
+func checkFaultSurfaced(err error, rejected bool) error {
+	switch {
+	case rejected && err == nil:
+		return fmt.Errorf("remote rejected the request, but it succeeded")
+	case !rejected && err != nil:
+		return fmt.Errorf("request failed without an injected fault: %s", err)
+	}
+	return nil
+}
+
+// checkNoRef confirms the actor holds no ref for a dataset whose transfer was
+// rejected. logs are transferred first, so they're expected to remain
+func checkNoRef(p *plan.Plan, ref dsref.Ref) error {
+	logGone, refGone := removeReceiverState(p, ref)
+	if !refGone {
+		return fmt.Errorf("rejected transfer of %s left a ref behind. log present: %t", ref.Human(), !logGone)
+	}
+	return nil
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/qri-io/qri/dsref"
+	"github.com/qri-io/test-plans/plan"
+	"github.com/testground/sdk-go/sync"
+)
+
+// interrupted push metric names
+const (
+	metricInterruptInterrupted    = "interrupt_push_interrupted"
+	metricInterruptFirstSuccess   = "interrupt_first_push_success"
+	metricInterruptRetrySuccess   = "interrupt_retry_success"
+	metricInterruptRetryDuration  = "interrupt_retry_duration_ms"
+	metricInterruptBlocksTotal    = "interrupt_blocks_total"
+	metricInterruptBlocksRetained = "interrupt_blocks_retained"
+	metricInterruptConsistent     = "interrupt_consistent"
+)
+
+var (
+	defaultInterruptAfter    = 500 * time.Millisecond
+	defaultInterruptDowntime = 2 * time.Second
+)
+
+var (
+	stateInterrupted   = sync.State("push interrupted")
+	stateBlocksCounted = sync.State("retained blocks counted")
+	stateRetried       = sync.State("push retried")
+)
+
+// interruptedPush describes the dataset a pusher is pushing, so receivers can
+// check how much of it arrived
+type interruptedPush struct {
+	Peername string
+	Path     string
+	Blocks   []string
+}
+
+var interruptedPushTopic = sync.NewTopic("interrupted-push", &interruptedPush{})
+
+// RunPlanInterruptedPush cuts pushers off from the network partway through
+// pushing a dataset, then retries the push once they're back online:
+// - pushers publish the blocks of the dataset they're about to push
+// - pushers start pushing & go offline after interrupt_after_ms
+// - once pushers are back online, receivers count the blocks they retained
+// - pushers retry the push
+// - receivers check they hold a complete, consistent copy of each dataset
+func RunPlanInterruptedPush(ctx context.Context, p *plan.Plan) error {
+	if err := p.AssignRoles(
+		plan.Role{Name: rolePusher, Weight: 1},
+		plan.Role{Name: roleReceiver, Weight: 1},
+	); err != nil {
+		return err
+	}
+	if err := p.SetupNetwork(ctx); err != nil {
+		return err
+	}
+	isReceiver := p.Role() == roleReceiver
+
+	constructor := newPusher
+	if isReceiver {
+		constructor = newReceiver
+	}
+	if err := p.ConstructActor(ctx, constructor); err != nil {
+		return err
+	}
+
+	// Share this node's info w/ all nodes on the network
+	if err := p.ShareInfo(ctx); err != nil {
+		return err
+	}
+
+	executeActions := interruptedPusherActions
+	if isReceiver {
+		executeActions = interruptedReceiverActions
+	}
+	if err := executeActions(ctx, p); err != nil {
+		p.Runenv.RecordFailure(err)
+	}
+	p.ActorFinished(ctx)
+	return p.Outcome(ctx)
+}
+
+func getInterruptTiming(p *plan.Plan) (after, downtime time.Duration) {
+	after, downtime = defaultInterruptAfter, defaultInterruptDowntime
+	if ms := p.Runenv.IntParam("interrupt_after_ms"); ms >= 0 {
+		after = time.Duration(ms) * time.Millisecond
+	}
+	if ms := p.Runenv.IntParam("interrupt_downtime_ms"); ms >= 0 {
+		downtime = time.Duration(ms) * time.Millisecond
+	}
+	return after, downtime
+}
+
+// interruptedPusherActions pushes, interrupting the push partway through, then
+// retries once receivers have counted the blocks they retained
+func interruptedPusherActions(ctx context.Context, p *plan.Plan) error {
+	ref := &dsref.Ref{Username: p.Actor.Peername(), Name: datasetName}
+	if _, err := p.Actor.Inst.ResolveReference(ctx, ref, "local"); err != nil {
+		return fmt.Errorf("resolving %s: %w", ref.Human(), err)
+	}
+	blocks, err := p.Actor.DAGNodes(ctx, ref.Path)
+	if err != nil {
+		return err
+	}
+	if _, err := p.Client.Publish(ctx, interruptedPushTopic, &interruptedPush{
+		Peername: ref.Username,
+		Path:     ref.Path,
+		Blocks:   blocks,
+	}); err != nil {
+		return fmt.Errorf("publishing push details: %w", err)
+	}
+
+	after, downtime := getInterruptTiming(p)
+	p.Runenv.RecordMessage("pushing %d blocks, interrupting after %s", len(blocks), after)
+	pushed := make(chan error, 1)
+	go func() {
+		pushed <- p.PushToRemotes(ctx, datasetName)
+	}()
+
+	var pushErr error
+	interrupted := false
+	select {
+	case <-time.After(after):
+		interrupted = true
+		if err := p.Interrupt(ctx, downtime); err != nil {
+			return err
+		}
+		pushErr = <-pushed
+	case pushErr = <-pushed:
+		p.Runenv.RecordMessage("push finished before it was interrupted, try a larger datasetBytes or smaller interrupt_after_ms")
+	}
+	if pushErr != nil {
+		p.Runenv.RecordMessage("interrupted push failed: %s", pushErr)
+	}
+	p.RecordPoint(metricInterruptInterrupted, boolPoint(interrupted))
+	p.RecordPoint(metricInterruptFirstSuccess, boolPoint(pushErr == nil))
+
+	p.Client.MustSignalEntry(ctx, stateInterrupted)
+	<-p.Client.MustBarrier(ctx, stateBlocksCounted, p.Roles.Count(roleReceiver)).C
+
+	p.Runenv.RecordMessage("retrying push")
+	start := time.Now()
+	retryErr := p.PushToRemotes(ctx, datasetName)
+	p.RecordPoint(metricInterruptRetryDuration, float64(time.Since(start).Milliseconds()))
+	p.RecordPoint(metricInterruptRetrySuccess, boolPoint(retryErr == nil))
+	p.Client.MustSignalEntry(ctx, stateRetried)
+	return retryErr
+}
+
+// interruptedReceiverActions counts the blocks of each pusher's dataset that
+// arrived before the interruption, then checks each dataset is complete once
+// pushes have been retried
+func interruptedReceiverActions(ctx context.Context, p *plan.Plan) error {
+	numPushers := p.Roles.Count(rolePusher)
+	<-p.Client.MustBarrier(ctx, stateInterrupted, numPushers).C
+
+	ch := make(chan *interruptedPush)
+	sub, err := p.Client.Subscribe(ctx, interruptedPushTopic, ch)
+	if err != nil {
+		return fmt.Errorf("push details subscription failure: %w", err)
+	}
+	pushes := make([]*interruptedPush, 0, numPushers)
+	for len(pushes) < numPushers {
+		select {
+		case push := <-ch:
+			pushes = append(pushes, push)
+		case err := <-sub.Done():
+			return err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	for _, push := range pushes {
+		retained, err := p.Actor.HasBlocks(push.Blocks)
+		if err != nil {
+			return err
+		}
+		p.Runenv.RecordMessage("retained %d of %d blocks pushed by %s", retained, len(push.Blocks), push.Peername)
+		p.RecordPoint(metricInterruptBlocksTotal, float64(len(push.Blocks)), "pusher", push.Peername)
+		p.RecordPoint(metricInterruptBlocksRetained, float64(retained), "pusher", push.Peername)
+	}
+
+	p.Client.MustSignalEntry(ctx, stateBlocksCounted)
+	<-p.Client.MustBarrier(ctx, stateRetried, numPushers).C
+
+	for _, push := range pushes {
+		err := checkPushConsistent(ctx, p, push)
+		p.RecordPoint(metricInterruptConsistent, boolPoint(err == nil), "pusher", push.Peername)
+		p.Assert("push_consistent", err)
+	}
+	return nil
+}
+
+// checkPushConsistent confirms the receiver's copy of a pushed dataset has the
+// pusher's head & every block
+func checkPushConsistent(ctx context.Context, p *plan.Plan, push *interruptedPush) error {
+	ref := &dsref.Ref{Username: push.Peername, Name: datasetName}
+	if _, err := p.Actor.Inst.ResolveReference(ctx, ref, "local"); err != nil {
+		return fmt.Errorf("resolving %s: %w", ref.Human(), err)
+	}
+	if ref.Path != push.Path {
+		return fmt.Errorf("%s head is %q, pusher's head is %q", ref.Human(), ref.Path, push.Path)
+	}
+	have, err := p.Actor.HasBlocks(push.Blocks)
+	if err != nil {
+		return err
+	}
+	if have != len(push.Blocks) {
+		return fmt.Errorf("%s is missing %d of %d blocks", ref.Human(), len(push.Blocks)-have, len(push.Blocks))
+	}
+	return nil
+}
+
+func boolPoint(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,67 @@
+package local
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/BurntSushi/toml"
+)
+
+// DefaultManifest is the manifest local runs read test case defaults from
+// unless Config.Manifest is set. it's relative to the working directory, which
+// is the repo root when running `go test` in package main
+const DefaultManifest = "manifest.toml"
+
+// manifest is the subset of a testground manifest.toml a local run uses
+type manifest struct {
+	TestCases []manifestTestCase `toml:"testcases"`
+}
+
+type manifestTestCase struct {
+	Name      string `toml:"name"`
+	Instances struct {
+		Default int `toml:"default"`
+	} `toml:"instances"`
+	Params map[string]struct {
+		Default interface{} `toml:"default"`
+	} `toml:"params"`
+}
+
+// ManifestDefaults reads the default instance count & params of testCase
+// from the manifest at path. params without a default are left out, the same
+// way testground leaves them unset
+func ManifestDefaults(path, testCase string) (instances int, params map[string]string, err error) {
+	m := &manifest{}
+	if _, err := toml.DecodeFile(path, m); err != nil {
+		return 0, nil, fmt.Errorf("reading manifest: %w", err)
+	}
+
+	for _, tc := range m.TestCases {
+		if tc.Name != testCase {
+			continue
+		}
+		params = map[string]string{}
+		for name, p := range tc.Params {
+			if p.Default == nil {
+				continue
+			}
+			if params[name], err = formatParam(p.Default); err != nil {
+				return 0, nil, fmt.Errorf("param %q: %w", name, err)
+			}
+		}
+		return tc.Instances.Default, params, nil
+	}
+	return 0, nil, fmt.Errorf("test case %q not found in %s", testCase, path)
+}
+
+// formatParam formats a manifest default as a testground param string
+func formatParam(v interface{}) (string, error) {
+	if s, ok := v.(string); ok {
+		return s, nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
@@ -0,0 +1,37 @@
+package local
+
+import (
+	"testing"
+)
+
+func TestManifestDefaults(t *testing.T) {
+	instances, params, err := ManifestDefaults("../manifest.toml", "push")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if instances != 2 {
+		t.Errorf("instances mismatch. expected: 2, got: %d", instances)
+	}
+
+	expect := map[string]string{
+		"timeout_secs":    "300",
+		"datasetRows":     "1000",
+		"datasetMutation": "append",
+		"loss":            "0",
+	}
+	for name, value := range expect {
+		if params[name] != value {
+			t.Errorf("param %q mismatch. expected: %q, got: %q", name, value, params[name])
+		}
+	}
+	// params without a default stay unset
+	for _, name := range []string{"datasetSeed", "link_rules"} {
+		if v, ok := params[name]; ok {
+			t.Errorf("expected param %q without a default to be unset, got: %q", name, v)
+		}
+	}
+
+	if _, _, err := ManifestDefaults("../manifest.toml", "not_a_test_case"); err == nil {
+		t.Error("expected an unknown test case to fail")
+	}
+}
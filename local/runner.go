@@ -0,0 +1,139 @@
+package local
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	gosync "sync"
+	"time"
+
+	"github.com/qri-io/test-plans/plan"
+	"github.com/testground/sdk-go/runtime"
+)
+
+// Config describes a local run
+type Config struct {
+	TestPlan string
+	TestCase string
+	// Instances is the number of plan instances to run. The test case's
+	// default instance count in the manifest is used if zero
+	Instances int
+	// Manifest is the path of the manifest.toml to read the test case's
+	// defaults from. DefaultManifest is used if empty
+	Manifest string
+	// Params are the testground parameters passed to each instance,
+	// overriding the test case's defaults in the manifest
+	Params map[string]string
+	// OutputsPath is the directory instance outputs are written to. A temp
+	// directory is created if empty
+	OutputsPath string
+}
+
+// Run executes fn once for each of cfg.Instances plan instances, each in its
+// own goroutine, all coordinating through a shared in-memory sync service.
+// Run blocks until all instances complete, returning an error describing each
+// instance that failed
+func Run(ctx context.Context, cfg Config, fn plan.RunFunc) error {
+	if cfg.TestPlan == "" {
+		cfg.TestPlan = "qri"
+	}
+	if cfg.Manifest == "" {
+		cfg.Manifest = DefaultManifest
+	}
+	instances, params, err := ManifestDefaults(cfg.Manifest, cfg.TestCase)
+	if err != nil {
+		return err
+	}
+	if cfg.Instances == 0 {
+		cfg.Instances = instances
+	}
+	if cfg.Instances < 1 {
+		return fmt.Errorf("local run needs at least one instance, got %d", cfg.Instances)
+	}
+	if cfg.OutputsPath == "" {
+		dir, err := ioutil.TempDir("", "qri_local_run")
+		if err != nil {
+			return err
+		}
+		cfg.OutputsPath = dir
+	}
+
+	for k, v := range cfg.Params {
+		params[k] = v
+	}
+
+	var (
+		svc   = NewService()
+		runID = fmt.Sprintf("local-%d", time.Now().UnixNano())
+		wg    gosync.WaitGroup
+		errs  = make([]error, cfg.Instances)
+	)
+
+	for i := 0; i < cfg.Instances; i++ {
+		outputsPath := filepath.Join(cfg.OutputsPath, fmt.Sprintf("%d", i))
+		if err := os.MkdirAll(outputsPath, os.ModePerm); err != nil {
+			return err
+		}
+		rp := runtime.RunParams{
+			TestPlan:               cfg.TestPlan,
+			TestCase:               cfg.TestCase,
+			TestRun:                runID,
+			TestOutputsPath:        outputsPath,
+			TestInstanceCount:      cfg.Instances,
+			TestInstanceParams:     params,
+			TestGroupID:            "single",
+			TestGroupInstanceCount: cfg.Instances,
+			TestStartTime:          time.Now(),
+		}
+
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if err := runInstance(ctx, rp, svc.Client(), fn); err != nil {
+				errs[i] = fmt.Errorf("instance %d: %w", i, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	var accErr error
+	for _, err := range errs {
+		if err == nil {
+			continue
+		}
+		if accErr == nil {
+			accErr = err
+			continue
+		}
+		accErr = fmt.Errorf("%s\n%s", accErr, err)
+	}
+	return accErr
+}
+
+// runInstance executes a single plan instance, recording the outcome the same
+// way the testground sdk's run.Invoke does
+func runInstance(ctx context.Context, rp runtime.RunParams, client *Client, fn plan.RunFunc) (err error) {
+	runenv := runtime.NewRunEnv(rp)
+	defer runenv.Close()
+	runenv.RecordStart()
+
+	p := plan.NewPlanWithClient(ctx, runenv, client)
+	ctx, done := context.WithTimeout(ctx, p.Cfg.Timeout)
+	defer func() {
+		if r := recover(); r != nil {
+			runenv.RecordCrash(r)
+			err = fmt.Errorf("panic: %v", r)
+		}
+		p.Close()
+		done()
+	}()
+
+	if err = fn(ctx, p); err != nil {
+		runenv.RecordFailure(err)
+		return err
+	}
+	runenv.RecordSuccess()
+	return nil
+}
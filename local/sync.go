@@ -0,0 +1,349 @@
+// Package local runs test plans in-process, without a testground daemon or
+// sync service
+package local
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	gosync "sync"
+	"unsafe"
+
+	"github.com/testground/sdk-go/runtime"
+	"github.com/testground/sdk-go/sync"
+)
+
+// Service is an in-memory stand-in for the testground sync service. A single
+// Service is shared by every instance in a local run, each instance talks to
+// it through its own Client
+type Service struct {
+	lk       gosync.Mutex
+	states   map[sync.State]int64
+	barriers map[sync.State][]*barrier
+	topics   map[string]*topic
+}
+
+type barrier struct {
+	target int64
+	ch     chan error
+	// done is closed when the barrier is released
+	done chan struct{}
+}
+
+// release fires the barrier with err. callers must hold the service lock
+func (b *barrier) release(err error) {
+	b.ch <- err
+	close(b.ch)
+	close(b.done)
+}
+
+// topic stores every payload published to it, as JSON, so late subscribers
+// receive the full history just like the real sync service
+type topic struct {
+	msgs [][]byte
+	// notify is closed & replaced each time a message is published
+	notify chan struct{}
+}
+
+// NewService creates an empty in-memory sync service
+func NewService() *Service {
+	return &Service{
+		states:   map[sync.State]int64{},
+		barriers: map[sync.State][]*barrier{},
+		topics:   map[string]*topic{},
+	}
+}
+
+// topicKey scopes all topics to an empty set of run params, a Service only
+// ever serves a single run
+func topicKey(t *sync.Topic) string {
+	return t.Key(&runtime.RunParams{})
+}
+
+func (s *Service) topic(key string) *topic {
+	t, ok := s.topics[key]
+	if !ok {
+		t = &topic{notify: make(chan struct{})}
+		s.topics[key] = t
+	}
+	return t
+}
+
+func (s *Service) publish(t *sync.Topic, payload interface{}) (int64, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return -1, fmt.Errorf("encoding payload: %w", err)
+	}
+
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	tp := s.topic(topicKey(t))
+	tp.msgs = append(tp.msgs, data)
+	close(tp.notify)
+	tp.notify = make(chan struct{})
+	return int64(len(tp.msgs)), nil
+}
+
+func (s *Service) subscribe(ctx context.Context, t *sync.Topic, ch interface{}) (*sync.Subscription, error) {
+	chV := reflect.ValueOf(ch)
+	if chV.Kind() != reflect.Chan {
+		return nil, fmt.Errorf("subscribe expects a channel, got %T", ch)
+	}
+	key := topicKey(t)
+	elemType := chV.Type().Elem()
+	sub, done := newSubscription()
+
+	go func() {
+		for i := 0; ; i++ {
+			s.lk.Lock()
+			tp := s.topic(key)
+			for i >= len(tp.msgs) {
+				notify := tp.notify
+				s.lk.Unlock()
+				select {
+				case <-notify:
+				case <-ctx.Done():
+					done <- ctx.Err()
+					return
+				}
+				s.lk.Lock()
+			}
+			data := tp.msgs[i]
+			s.lk.Unlock()
+
+			v, err := decodePayload(data, elemType)
+			if err != nil {
+				done <- fmt.Errorf("decoding %s payload: %w", key, err)
+				return
+			}
+			chosen, _, _ := reflect.Select([]reflect.SelectCase{
+				{Dir: reflect.SelectSend, Chan: chV, Send: v},
+				{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ctx.Done())},
+			})
+			if chosen == 1 {
+				done <- ctx.Err()
+				return
+			}
+		}
+	}()
+
+	return sub, nil
+}
+
+// newSubscription creates a subscription whose Done channel is done.
+// sync.Subscription doesn't export its done channel, so it's set through
+// reflection, which depends on the field layout of the pinned sdk-go version
+func newSubscription() (*sync.Subscription, chan error) {
+	sub := &sync.Subscription{}
+	done := make(chan error, 1)
+	f := reflect.ValueOf(sub).Elem().FieldByName("doneCh")
+	reflect.NewAt(f.Type(), unsafe.Pointer(f.UnsafeAddr())).Elem().Set(reflect.ValueOf(done))
+	return sub, done
+}
+
+// decodePayload unmarshals JSON data into a new value of type typ
+func decodePayload(data []byte, typ reflect.Type) (reflect.Value, error) {
+	if typ.Kind() == reflect.Ptr {
+		v := reflect.New(typ.Elem())
+		err := json.Unmarshal(data, v.Interface())
+		return v, err
+	}
+	v := reflect.New(typ)
+	err := json.Unmarshal(data, v.Interface())
+	return v.Elem(), err
+}
+
+func (s *Service) barrier(ctx context.Context, state sync.State, target int) *sync.Barrier {
+	b := &barrier{target: int64(target), ch: make(chan error, 1), done: make(chan struct{})}
+
+	s.lk.Lock()
+	if s.states[state] >= b.target {
+		b.release(nil)
+		s.lk.Unlock()
+		return &sync.Barrier{C: b.ch}
+	}
+	s.barriers[state] = append(s.barriers[state], b)
+	s.lk.Unlock()
+
+	go func() {
+		select {
+		case <-b.done:
+			return
+		case <-ctx.Done():
+		}
+		s.lk.Lock()
+		defer s.lk.Unlock()
+		for i, waiting := range s.barriers[state] {
+			if waiting == b {
+				s.barriers[state] = append(s.barriers[state][:i], s.barriers[state][i+1:]...)
+				b.release(ctx.Err())
+				return
+			}
+		}
+	}()
+
+	return &sync.Barrier{C: b.ch}
+}
+
+func (s *Service) signalEntry(state sync.State) int64 {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+
+	s.states[state]++
+	count := s.states[state]
+
+	waiting := s.barriers[state][:0]
+	for _, b := range s.barriers[state] {
+		if count >= b.target {
+			b.release(nil)
+			continue
+		}
+		waiting = append(waiting, b)
+	}
+	s.barriers[state] = waiting
+
+	return count
+}
+
+// Client creates a sync client bound to this service
+func (s *Service) Client() *Client {
+	return &Client{s: s}
+}
+
+// Client implements the testground sync.Client interface on top of an
+// in-memory Service
+type Client struct {
+	s *Service
+}
+
+// assert at compile time that Client is a sync.Client
+var _ sync.Client = (*Client)(nil)
+
+// Close is a no-op, the underlying service outlives any single client
+func (c *Client) Close() error {
+	return nil
+}
+
+// Publish writes payload to topic
+func (c *Client) Publish(ctx context.Context, topic *sync.Topic, payload interface{}) (int64, error) {
+	return c.s.publish(topic, payload)
+}
+
+// Subscribe delivers every payload published to topic, past & future, on ch
+// until ctx is cancelled
+func (c *Client) Subscribe(ctx context.Context, topic *sync.Topic, ch interface{}) (*sync.Subscription, error) {
+	return c.s.subscribe(ctx, topic, ch)
+}
+
+// PublishAndWait publishes payload, then waits for state to reach target
+func (c *Client) PublishAndWait(ctx context.Context, topic *sync.Topic, payload interface{}, state sync.State, target int) (int64, error) {
+	seq, err := c.Publish(ctx, topic, payload)
+	if err != nil {
+		return -1, err
+	}
+	b, err := c.Barrier(ctx, state, target)
+	if err != nil {
+		return seq, err
+	}
+	return seq, <-b.C
+}
+
+// PublishSubscribe publishes payload, then subscribes to topic
+func (c *Client) PublishSubscribe(ctx context.Context, topic *sync.Topic, payload interface{}, ch interface{}) (int64, *sync.Subscription, error) {
+	seq, err := c.Publish(ctx, topic, payload)
+	if err != nil {
+		return -1, nil, err
+	}
+	sub, err := c.Subscribe(ctx, topic, ch)
+	if err != nil {
+		return seq, nil, err
+	}
+	return seq, sub, nil
+}
+
+// Barrier returns a barrier that fires once state reaches target entries
+func (c *Client) Barrier(ctx context.Context, state sync.State, target int) (*sync.Barrier, error) {
+	return c.s.barrier(ctx, state, target), nil
+}
+
+// SignalEntry increments the entry count for state
+func (c *Client) SignalEntry(ctx context.Context, state sync.State) (int64, error) {
+	return c.s.signalEntry(state), nil
+}
+
+// SignalAndWait signals entry into state & waits for it to reach target
+func (c *Client) SignalAndWait(ctx context.Context, state sync.State, target int) (int64, error) {
+	seq, err := c.SignalEntry(ctx, state)
+	if err != nil {
+		return -1, err
+	}
+	b, err := c.Barrier(ctx, state, target)
+	if err != nil {
+		return seq, err
+	}
+	return seq, <-b.C
+}
+
+// MustBarrier calls Barrier, panicking on error
+func (c *Client) MustBarrier(ctx context.Context, state sync.State, target int) *sync.Barrier {
+	b, err := c.Barrier(ctx, state, target)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+// MustSignalEntry calls SignalEntry, panicking on error
+func (c *Client) MustSignalEntry(ctx context.Context, state sync.State) int64 {
+	seq, err := c.SignalEntry(ctx, state)
+	if err != nil {
+		panic(err)
+	}
+	return seq
+}
+
+// MustSubscribe calls Subscribe, panicking on error
+func (c *Client) MustSubscribe(ctx context.Context, topic *sync.Topic, ch interface{}) *sync.Subscription {
+	sub, err := c.Subscribe(ctx, topic, ch)
+	if err != nil {
+		panic(err)
+	}
+	return sub
+}
+
+// MustPublish calls Publish, panicking on error
+func (c *Client) MustPublish(ctx context.Context, topic *sync.Topic, payload interface{}) int64 {
+	seq, err := c.Publish(ctx, topic, payload)
+	if err != nil {
+		panic(err)
+	}
+	return seq
+}
+
+// MustPublishAndWait calls PublishAndWait, panicking on error
+func (c *Client) MustPublishAndWait(ctx context.Context, topic *sync.Topic, payload interface{}, state sync.State, target int) int64 {
+	seq, err := c.PublishAndWait(ctx, topic, payload, state, target)
+	if err != nil {
+		panic(err)
+	}
+	return seq
+}
+
+// MustPublishSubscribe calls PublishSubscribe, panicking on error
+func (c *Client) MustPublishSubscribe(ctx context.Context, topic *sync.Topic, payload interface{}, ch interface{}) (int64, *sync.Subscription) {
+	seq, sub, err := c.PublishSubscribe(ctx, topic, payload, ch)
+	if err != nil {
+		panic(err)
+	}
+	return seq, sub
+}
+
+// MustSignalAndWait calls SignalAndWait, panicking on error
+func (c *Client) MustSignalAndWait(ctx context.Context, state sync.State, target int) int64 {
+	seq, err := c.SignalAndWait(ctx, state, target)
+	if err != nil {
+		panic(err)
+	}
+	return seq
+}
@@ -0,0 +1,203 @@
+package local
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/testground/sdk-go/sync"
+)
+
+func TestBarrierReleasesAtTarget(t *testing.T) {
+	ctx := context.Background()
+	svc := NewService()
+	a, b := svc.Client(), svc.Client()
+	state := sync.State("ready")
+
+	barrier := a.MustBarrier(ctx, state, 2)
+	if count := a.MustSignalEntry(ctx, state); count != 1 {
+		t.Errorf("first signal count mismatch. expected: 1, got: %d", count)
+	}
+	select {
+	case err := <-barrier.C:
+		t.Fatalf("barrier released before reaching its target, err: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	if count := b.MustSignalEntry(ctx, state); count != 2 {
+		t.Errorf("second signal count mismatch. expected: 2, got: %d", count)
+	}
+	select {
+	case err := <-barrier.C:
+		if err != nil {
+			t.Errorf("unexpected barrier error: %s", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("barrier didn't release once its target was reached")
+	}
+}
+
+func TestBarrierAlreadyReached(t *testing.T) {
+	ctx := context.Background()
+	svc := NewService()
+	c := svc.Client()
+	state := sync.State("done")
+
+	c.MustSignalEntry(ctx, state)
+	c.MustSignalEntry(ctx, state)
+
+	select {
+	case err := <-c.MustBarrier(ctx, state, 2).C:
+		if err != nil {
+			t.Errorf("unexpected barrier error: %s", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("barrier on a state that already reached its target didn't release")
+	}
+}
+
+func TestBarrierCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	svc := NewService()
+	c := svc.Client()
+	state := sync.State("never")
+
+	barrier := c.MustBarrier(ctx, state, 1)
+	cancel()
+
+	select {
+	case err := <-barrier.C:
+		if err != context.Canceled {
+			t.Errorf("error mismatch. expected: %v, got: %v", context.Canceled, err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("cancelled barrier didn't release")
+	}
+
+	// signalling after the barrier was cancelled must not block or panic
+	c.MustSignalEntry(context.Background(), state)
+}
+
+func TestSignalAndWait(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	svc := NewService()
+	state := sync.State("assign-seq")
+
+	seqs := make(chan int64, 3)
+	for i := 0; i < 3; i++ {
+		go func() {
+			seqs <- svc.Client().MustSignalAndWait(ctx, state, 3)
+		}()
+	}
+
+	got := map[int64]bool{}
+	for i := 0; i < 3; i++ {
+		select {
+		case seq := <-seqs:
+			got[seq] = true
+		case <-ctx.Done():
+			t.Fatal("SignalAndWait didn't return once every client signalled")
+		}
+	}
+	for seq := int64(1); seq <= 3; seq++ {
+		if !got[seq] {
+			t.Errorf("expected a client to be assigned seq %d, got: %v", seq, got)
+		}
+	}
+}
+
+type testPayload struct {
+	Name  string
+	Count int
+}
+
+func TestTopicHistory(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	svc := NewService()
+	pub, sub := svc.Client(), svc.Client()
+	topic := sync.NewTopic("payloads", &testPayload{})
+
+	if seq := pub.MustPublish(ctx, topic, &testPayload{Name: "a", Count: 1}); seq != 1 {
+		t.Errorf("first publish seq mismatch. expected: 1, got: %d", seq)
+	}
+
+	// late subscribers receive every earlier payload, then later ones
+	ch := make(chan *testPayload)
+	sub.MustSubscribe(ctx, topic, ch)
+	pub.MustPublish(ctx, topic, &testPayload{Name: "b", Count: 2})
+
+	for _, expect := range []testPayload{{"a", 1}, {"b", 2}} {
+		select {
+		case got := <-ch:
+			if *got != expect {
+				t.Errorf("payload mismatch. expected: %v, got: %v", expect, *got)
+			}
+		case <-ctx.Done():
+			t.Fatalf("timed out waiting for payload %v", expect)
+		}
+	}
+}
+
+func TestTopicValueChannel(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	svc := NewService()
+	c := svc.Client()
+	topic := sync.NewTopic("values", "")
+
+	ch := make(chan string)
+	c.MustPublishSubscribe(ctx, topic, "hello", ch)
+
+	select {
+	case got := <-ch:
+		if got != "hello" {
+			t.Errorf("payload mismatch. expected: %q, got: %q", "hello", got)
+		}
+	case <-ctx.Done():
+		t.Fatal("timed out waiting for payload")
+	}
+}
+
+func TestSubscribeNotChannel(t *testing.T) {
+	c := NewService().Client()
+	if _, err := c.Subscribe(context.Background(), sync.NewTopic("x", ""), "not a channel"); err == nil {
+		t.Error("expected subscribing with a non-channel to fail")
+	}
+}
+
+func TestSubscriptionDoneOnCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	c := NewService().Client()
+
+	sub := c.MustSubscribe(ctx, sync.NewTopic("cancelled", ""), make(chan string))
+	cancel()
+
+	select {
+	case err := <-sub.Done():
+		if err != context.Canceled {
+			t.Errorf("error mismatch. expected: %v, got: %v", context.Canceled, err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("subscription wasn't done once its context was cancelled")
+	}
+}
+
+func TestSubscriptionDoneOnDecodeError(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	c := NewService().Client()
+
+	c.MustPublish(ctx, sync.NewTopic("mixed", ""), "not a payload")
+	sub := c.MustSubscribe(ctx, sync.NewTopic("mixed", &testPayload{}), make(chan *testPayload))
+
+	select {
+	case err := <-sub.Done():
+		if err == nil {
+			t.Error("expected a payload that doesn't decode to fail the subscription")
+		}
+	case <-ctx.Done():
+		t.Fatal("subscription wasn't done after a payload failed to decode")
+	}
+}
@@ -10,6 +10,19 @@ import (
 	"github.com/testground/sdk-go/runtime"
 )
 
+// testcases maps manifest test case names to the functions that run them.
+// the same functions can be executed without testground using package local
+var testcases = map[string]plan.RunFunc{
+	"push":            RunPlanRemotePushPull,
+	"pull":            RunPlanRemotePull,
+	"profile_service": RunPlanProfileService,
+	"scenario":        RunPlanScenario,
+	"partition":       RunPlanPartition,
+	"interrupt":       RunPlanInterruptedPush,
+	"remove":          RunPlanRemove,
+	"hook_faults":     RunPlanHookFaults,
+}
+
 func main() {
 	sdk_run.Invoke(run)
 }
@@ -19,19 +32,14 @@ func run(runenv *runtime.RunEnv) error {
 	p := plan.NewPlan(ctx, runenv)
 	ctx, done := context.WithTimeout(ctx, p.Cfg.Timeout)
 	defer func() {
-		p.Client.Close()
+		p.Close()
 		done()
 	}()
 
-	switch c := runenv.TestCase; c {
-	case "push":
-		return RunPlanRemotePushPull(ctx, p)
-	case "pull":
-		return RunPlanRemotePull(ctx, p)
-	case "profile_service":
-		return RunPlanProfileService(ctx, p)
-	default:
-		msg := fmt.Sprintf("Unknown TestCase %s", c)
+	runPlan, ok := testcases[runenv.TestCase]
+	if !ok {
+		msg := fmt.Sprintf("Unknown TestCase %s", runenv.TestCase)
 		return errors.New(msg)
 	}
+	return runPlan(ctx, p)
 }
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/qri-io/test-plans/local"
+)
+
+// TestLocalRun runs test cases in-process through the local runner, with the
+// defaults in manifest.toml & a small dataset to keep runs quick
+func TestLocalRun(t *testing.T) {
+	if testing.Short() {
+		t.Skip("local runs start a qri node per instance")
+	}
+
+	for _, testCase := range []string{"push", "pull", "profile_service"} {
+		t.Run(testCase, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "qri_local_run_test")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+
+			cfg := local.Config{
+				TestCase: testCase,
+				Params: map[string]string{
+					"timeout_secs": "120",
+					"datasetRows":  "100",
+				},
+				OutputsPath: dir,
+			}
+			if err := local.Run(context.Background(), cfg, testcases[testCase]); err != nil {
+				t.Errorf("running %s: %s", testCase, err)
+			}
+		})
+	}
+}
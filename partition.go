@@ -0,0 +1,233 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/qri-io/qri/dsref"
+	"github.com/qri-io/test-plans/plan"
+	"github.com/qri-io/test-plans/sim"
+	"github.com/testground/sdk-go/sync"
+)
+
+const (
+	roleAuthor           = "author"
+	partitionDatasetName = "tectonics"
+)
+
+var (
+	stateInitialPush     = sync.State("initial push")
+	statePartition       = sync.State("partition")
+	statePartitionedPush = sync.State("partitioned push")
+	stateHeal            = sync.State("heal")
+	stateHealedPush      = sync.State("healed push")
+)
+
+// authorHead is the latest version of an author's dataset, published by each
+// author once it has pushed after the partition heals
+type authorHead struct {
+	Peername string
+	Path     string
+	Versions int
+}
+
+var authorHeadTopic = sync.NewTopic("author-head", &authorHead{})
+
+// RunPlanPartition splits the network in two while authors push new versions
+// of their datasets to every remote, then heals the partition, pushes again &
+// checks every remote has reconciled each author's logbook & dataset ref:
+//   - authors push a first version to all remotes
+//   - the network is partitioned, authors save & push a second version. pushes
+//     to remotes across the partition are expected to fail
+//   - the partition heals, authors push again
+//   - remotes check they hold every author's latest version & full history
+func RunPlanPartition(ctx context.Context, p *plan.Plan) error {
+	if p.Runenv.TestInstanceCount < 4 {
+		return fmt.Errorf("partition test case requires at least 4 instances, got %d", p.Runenv.TestInstanceCount)
+	}
+	if err := p.AssignRoles(
+		plan.Role{Name: roleAuthor, Weight: 1},
+		plan.Role{Name: roleRemote, Weight: 1},
+	); err != nil {
+		return err
+	}
+	if err := p.SetupNetwork(ctx); err != nil {
+		return err
+	}
+	isRemote := p.Role() == roleRemote
+
+	constructor := newAuthor
+	if isRemote {
+		constructor = newReceiver
+	}
+	if err := p.ConstructActor(ctx, constructor); err != nil {
+		return err
+	}
+
+	// Share this node's info w/ all nodes on the network
+	if err := p.ShareInfo(ctx); err != nil {
+		return err
+	}
+
+	partition, err := plan.SplitPartition(p.Runenv.TestInstanceCount, 2)
+	if err != nil {
+		return err
+	}
+
+	if err := partitionActions(ctx, p, partition, isRemote); err != nil {
+		p.Runenv.RecordFailure(err)
+	}
+	p.ActorFinished(ctx)
+	return p.Outcome(ctx)
+}
+
+// partitionActions runs the partition test case. every instance must move
+// through the same sync states, so errors that aren't fatal to the run are
+// recorded & returned after the final state
+func partitionActions(ctx context.Context, p *plan.Plan, partition plan.Partition, isRemote bool) error {
+	instances := p.Runenv.TestInstanceCount
+	var failed error
+
+	if !isRemote {
+		p.Runenv.RecordMessage("pushing first version")
+		if err := p.PushToRemotes(ctx, partitionDatasetName); err != nil {
+			failed = fmt.Errorf("pushing before partition: %w", err)
+		}
+	}
+	p.Client.MustSignalAndWait(ctx, stateInitialPush, instances)
+
+	if err := p.PartitionAt(ctx, statePartition, partition); err != nil {
+		return err
+	}
+	if !isRemote {
+		p.Runenv.RecordMessage("pushing second version while partitioned")
+		if err := p.Actor.GenerateDatasetVersion(partitionDatasetName, getDatasetRows(p)); err != nil {
+			return err
+		}
+		if err := p.PushToRemotes(ctx, partitionDatasetName); err != nil {
+			p.Runenv.RecordMessage("pushing while partitioned: %s", err)
+		}
+	}
+	p.Client.MustSignalAndWait(ctx, statePartitionedPush, instances)
+
+	if err := p.HealAt(ctx, stateHeal); err != nil {
+		return err
+	}
+	if !isRemote {
+		p.Runenv.RecordMessage("pushing after healing")
+		if err := p.PushToRemotes(ctx, partitionDatasetName); err != nil && failed == nil {
+			failed = fmt.Errorf("pushing after healing: %w", err)
+		}
+		if err := publishAuthorHead(ctx, p); err != nil {
+			return err
+		}
+	}
+	p.Client.MustSignalAndWait(ctx, stateHealedPush, instances)
+
+	if isRemote {
+		p.Assert("refs_reconciled", checkReconciled(ctx, p))
+	}
+	return failed
+}
+
+func newAuthor(ctx context.Context, p *plan.Plan) (*sim.Actor, error) {
+	act, err := sim.NewActor(ctx, p.Runenv, p.Client, p.Seq)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := act.GenerateDatasetVersion(partitionDatasetName, getDatasetRows(p)); err != nil {
+		return nil, err
+	}
+
+	if err := act.Inst.Connect(ctx); err != nil {
+		return nil, err
+	}
+
+	if err := p.ReceiveRemoteInfo(ctx, act, p.Roles.Count(roleRemote)); err != nil {
+		return nil, err
+	}
+
+	p.Runenv.RecordMessage("I'm an Author named %s", act.Peername())
+	p.Runenv.RecordMessage("My qri ID is %s", act.ID())
+	p.Runenv.RecordMessage("My peer ID is %s", act.AddrInfo().ID)
+	return act, nil
+}
+
+// publishAuthorHead shares the author's latest version & history length
+func publishAuthorHead(ctx context.Context, p *plan.Plan) error {
+	ref := dsref.Ref{Username: p.Actor.Peername(), Name: partitionDatasetName}
+	book := p.Actor.Inst.Repo().Logbook()
+	if _, err := book.ResolveRef(ctx, &ref); err != nil {
+		return fmt.Errorf("resolving own dataset: %w", err)
+	}
+	items, err := book.Items(ctx, ref, 0, -1)
+	if err != nil {
+		return err
+	}
+
+	_, err = p.Client.Publish(ctx, authorHeadTopic, &authorHead{
+		Peername: ref.Username,
+		Path:     ref.Path,
+		Versions: len(items),
+	})
+	return err
+}
+
+// checkReconciled compares every author's head to the remote's logbook,
+// recording the number of reconciled & diverged refs
+func checkReconciled(ctx context.Context, p *plan.Plan) error {
+	numAuthors := p.Roles.Count(roleAuthor)
+	ch := make(chan *authorHead)
+	sub, err := p.Client.Subscribe(ctx, authorHeadTopic, ch)
+	if err != nil {
+		return fmt.Errorf("author head subscription failure: %w", err)
+	}
+
+	book := p.Actor.Inst.Repo().Logbook()
+	reconciled, diverged := 0, 0
+	var accErr error
+	for i := 0; i < numAuthors; i++ {
+		var head *authorHead
+		select {
+		case head = <-ch:
+		case err := <-sub.Done():
+			return err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+
+		ref := dsref.Ref{Username: head.Peername, Name: partitionDatasetName}
+		err := func() error {
+			if _, err := book.ResolveRef(ctx, &ref); err != nil {
+				return fmt.Errorf("resolving %s: %w", ref.Human(), err)
+			}
+			if ref.Path != head.Path {
+				return fmt.Errorf("%s head is %q, author's head is %q", ref.Human(), ref.Path, head.Path)
+			}
+			items, err := book.Items(ctx, ref, 0, -1)
+			if err != nil {
+				return fmt.Errorf("listing %s history: %w", ref.Human(), err)
+			}
+			if len(items) != head.Versions {
+				return fmt.Errorf("%s has %d versions, author has %d", ref.Human(), len(items), head.Versions)
+			}
+			return nil
+		}()
+		if err != nil {
+			diverged++
+			if accErr == nil {
+				accErr = err
+			} else {
+				accErr = fmt.Errorf("%s\n%s", accErr, err)
+			}
+			continue
+		}
+		reconciled++
+	}
+
+	p.Runenv.RecordMessage("%d of %d author refs reconciled after healing", reconciled, numAuthors)
+	p.RecordPoint("partition_refs_reconciled", float64(reconciled))
+	p.RecordPoint("partition_refs_diverged", float64(diverged))
+	return accErr
+}
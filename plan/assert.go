@@ -0,0 +1,172 @@
+package plan
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	gosync "sync"
+
+	"github.com/qri-io/qri/dsref"
+)
+
+// MetricAssertionPassed is recorded for every assertion, 1 if it passed & 0
+// if it failed, tagged with "assertion"
+const MetricAssertionPassed = "assertion_passed"
+
+// assertionsAsset is the name of the output file assertion results are
+// written to, one JSON object per line
+const assertionsAsset = "assertions.json"
+
+// AssertionResult is the structured outcome of a single assertion
+type AssertionResult struct {
+	Name    string `json:"name"`
+	Role    string `json:"role"`
+	Seq     int64  `json:"seq"`
+	Passed  bool   `json:"passed"`
+	Message string `json:"message,omitempty"`
+}
+
+// AssertionError is the outcome of a run where at least one assertion failed
+type AssertionError struct {
+	Failures []AssertionResult
+}
+
+// Error implements the error interface
+func (e *AssertionError) Error() string {
+	msgs := make([]string, len(e.Failures))
+	for i, f := range e.Failures {
+		msgs[i] = fmt.Sprintf("%s: %s", f.Name, f.Message)
+	}
+	return fmt.Sprintf("%d assertions failed:\n%s", len(e.Failures), strings.Join(msgs, "\n"))
+}
+
+// assertionResults collects the assertions made by a plan instance, safe for
+// concurrent use
+type assertionResults struct {
+	lk      gosync.Mutex
+	results []AssertionResult
+}
+
+func (a *assertionResults) add(res AssertionResult) {
+	a.lk.Lock()
+	defer a.lk.Unlock()
+	a.results = append(a.results, res)
+}
+
+func (a *assertionResults) list() []AssertionResult {
+	a.lk.Lock()
+	defer a.lk.Unlock()
+	return append([]AssertionResult(nil), a.results...)
+}
+
+// Assert records the outcome of a named check on this instance's end state.
+// a nil err passes. Failed assertions don't stop the run, but they fail it
+// once Outcome is called. names become metric tags, so they should be
+// snake_case. Assert returns whether the assertion passed
+func (plan *Plan) Assert(name string, err error) bool {
+	res := AssertionResult{
+		Name:   name,
+		Role:   plan.Role(),
+		Seq:    plan.Seq,
+		Passed: err == nil,
+	}
+	if err != nil {
+		res.Message = err.Error()
+		plan.Runenv.RecordMessage("assertion %q failed: %s", name, err)
+	} else {
+		plan.Runenv.RecordMessage("assertion %q passed", name)
+	}
+	plan.assertions.add(res)
+
+	passed := 0.0
+	if res.Passed {
+		passed = 1
+	}
+	plan.RecordPoint(MetricAssertionPassed, passed, "assertion", name)
+	return res.Passed
+}
+
+// Outcome waits for every instance to finish, writes this instance's
+// assertion results to an output file, & returns the result of the run: an
+// error if the plan didn't finish, an *AssertionError if any assertion failed,
+// nil otherwise
+func (plan *Plan) Outcome(ctx context.Context) error {
+	select {
+	case err := <-plan.Finished(ctx):
+		if err != nil {
+			return err
+		}
+	case <-ctx.Done():
+		return fmt.Errorf("waiting for every instance to finish: %w", ctx.Err())
+	}
+
+	results := plan.assertions.list()
+	if err := plan.writeAssertions(results); err != nil {
+		plan.Runenv.RecordMessage("error writing assertion results: %s", err)
+	}
+
+	var failures []AssertionResult
+	for _, res := range results {
+		if !res.Passed {
+			failures = append(failures, res)
+		}
+	}
+	plan.Runenv.RecordMessage("%d of %d assertions passed", len(results)-len(failures), len(results))
+	if len(failures) > 0 {
+		return &AssertionError{Failures: failures}
+	}
+	return nil
+}
+
+func (plan *Plan) writeAssertions(results []AssertionResult) error {
+	f, err := plan.Runenv.CreateRawAsset(assertionsAsset)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	enc := json.NewEncoder(f)
+	for _, res := range results {
+		if err := enc.Encode(res); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ExpectForeignDatasets checks the actor's logbook holds logs for exactly
+// datasets datasets authored by profiles distinct peers other than itself
+func (plan *Plan) ExpectForeignDatasets(ctx context.Context, datasets, profiles int) error {
+	logs, err := plan.Actor.Inst.Repo().Logbook().ListAllLogs(ctx)
+	if err != nil {
+		return fmt.Errorf("listing logs: %w", err)
+	}
+	gotDatasets, gotProfiles := 0, 0
+	for _, log := range logs {
+		if log.Name() == plan.Actor.Peername() || len(log.Logs) == 0 {
+			continue
+		}
+		gotProfiles++
+		gotDatasets += len(log.Logs)
+	}
+	if gotDatasets != datasets || gotProfiles != profiles {
+		return fmt.Errorf("expected %d datasets from %d profiles, found %d datasets from %d profiles", datasets, profiles, gotDatasets, gotProfiles)
+	}
+	return nil
+}
+
+// ExpectDataset checks the actor can resolve ref locally to a complete
+// reference. if path is given, the resolved head must match it
+func (plan *Plan) ExpectDataset(ctx context.Context, ref dsref.Ref, path string) error {
+	if _, err := plan.Actor.Inst.ResolveReference(ctx, &ref, "local"); err != nil {
+		return fmt.Errorf("resolving %s: %w", ref.Human(), err)
+	}
+	if !ref.Complete() {
+		return fmt.Errorf("%s resolved to an incomplete reference", ref.Human())
+	}
+	if path != "" && ref.Path != path {
+		return fmt.Errorf("%s head is %q, expected %q", ref.Human(), ref.Path, path)
+	}
+	return nil
+}
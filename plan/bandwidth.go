@@ -0,0 +1,119 @@
+package plan
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/libp2p/go-libp2p-core/metrics"
+	"github.com/qri-io/test-plans/sim"
+)
+
+// bandwidthSettle is how long RecordBandwidth waits for the bandwidth
+// reporter to fold the last second of traffic into its totals
+const bandwidthSettle = 1100 * time.Millisecond
+
+// RecordBandwidth records the bytes the actor's libp2p host sent & received
+// since the last call, ending a named phase of the test. Bytes are recorded
+// in total, per protocol & per peer, tagged with the phase and a direction of
+// "in" or "out". Zero counts are skipped. Calling RecordBandwidth at the end of
+// each phase puts a number on the overhead of qri's protocols next to bitswap
+func (plan *Plan) RecordBandwidth(ctx context.Context, phase string) error {
+	select {
+	case <-time.After(bandwidthSettle):
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	stats, err := plan.Actor.Bandwidth()
+	if err != nil {
+		if errors.Is(err, sim.ErrNoBandwidthReporter) {
+			plan.Runenv.RecordMessage("%s: bandwidth not recorded: %s", phase, err)
+			return nil
+		}
+		return err
+	}
+	prev := plan.bandwidth
+	if prev == nil {
+		prev = &sim.BandwidthStats{}
+	}
+	plan.bandwidth = stats
+
+	total := statsDelta(stats.Total, prev.Total)
+	plan.recordBandwidthPoints(MetricBandwidthTotalBytes, total, "phase", phase)
+
+	families := map[string]metrics.Stats{}
+	for _, proto := range sortedStatKeys(stats.ByProtocol) {
+		d := statsDelta(stats.ByProtocol[proto], prev.ByProtocol[proto])
+		family := sim.ProtocolFamily(proto)
+		f := families[family]
+		f.TotalIn += d.TotalIn
+		f.TotalOut += d.TotalOut
+		families[family] = f
+		plan.recordBandwidthPoints(MetricBandwidthProtocolBytes, d, "phase", phase, "protocol", metricTagValue(proto), "family", family)
+	}
+
+	peernames := map[string]string{}
+	for _, info := range plan.Others {
+		if info.AddrInfo != nil {
+			peernames[info.AddrInfo.ID.Pretty()] = info.Peername
+		}
+	}
+	for _, pid := range sortedStatKeys(stats.ByPeer) {
+		d := statsDelta(stats.ByPeer[pid], prev.ByPeer[pid])
+		peer, ok := peernames[pid]
+		if !ok {
+			peer = pid
+		}
+		plan.recordBandwidthPoints(MetricBandwidthPeerBytes, d, "phase", phase, "peer", peer)
+	}
+
+	plan.Runenv.RecordMessage("%s: %d bytes in, %d bytes out. qri %d/%d, bitswap %d/%d", phase,
+		total.TotalIn, total.TotalOut,
+		families[sim.ProtocolFamilyQri].TotalIn, families[sim.ProtocolFamilyQri].TotalOut,
+		families[sim.ProtocolFamilyBitswap].TotalIn, families[sim.ProtocolFamilyBitswap].TotalOut)
+	return nil
+}
+
+// recordBandwidthPoints records nonzero inbound & outbound byte counts of s
+func (plan *Plan) recordBandwidthPoints(name string, s metrics.Stats, kv ...string) {
+	kv = append(kv[:len(kv):len(kv)], "direction", "")
+	if s.TotalIn > 0 {
+		kv[len(kv)-1] = "in"
+		plan.RecordPoint(name, float64(s.TotalIn), kv...)
+	}
+	if s.TotalOut > 0 {
+		kv[len(kv)-1] = "out"
+		plan.RecordPoint(name, float64(s.TotalOut), kv...)
+	}
+}
+
+// statsDelta returns the bytes counted between prev & cur. counts that went
+// down belong to a new reporter, created when the actor went back online, and
+// are returned as-is
+func statsDelta(cur, prev metrics.Stats) metrics.Stats {
+	d := metrics.Stats{TotalIn: cur.TotalIn, TotalOut: cur.TotalOut}
+	if cur.TotalIn >= prev.TotalIn {
+		d.TotalIn -= prev.TotalIn
+	}
+	if cur.TotalOut >= prev.TotalOut {
+		d.TotalOut -= prev.TotalOut
+	}
+	return d
+}
+
+func sortedStatKeys(m map[string]metrics.Stats) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// metricTagValue replaces the characters that separate tags in a metric name
+func metricTagValue(s string) string {
+	return strings.NewReplacer(",", "_", "=", "_", " ", "_").Replace(s)
+}
@@ -0,0 +1,166 @@
+package plan
+
+import (
+	"context"
+	"math/rand"
+	"time"
+
+	"github.com/testground/sdk-go/runtime"
+)
+
+// Churn metric names, recorded once churn stops
+const (
+	MetricChurnEvents             = "churn_events"
+	MetricChurnDowntime           = "churn_downtime_ms"
+	MetricChurnTransfersAttempted = "churn_transfers_attempted"
+	MetricChurnTransfersSurvived  = "churn_transfers_survived"
+)
+
+// ChurnConfig configures how often an instance drops off the network while
+// a plan runs
+type ChurnConfig struct {
+	// Rate is the probability from 0 to 1 that an instance goes offline at
+	// each Interval. A zero rate disables churn
+	Rate     float64
+	Interval time.Duration
+	// instances stay offline for a duration chosen uniformly between
+	// MinDowntime & MaxDowntime
+	MinDowntime time.Duration
+	MaxDowntime time.Duration
+}
+
+// ChurnConfigFromRuntimeEnv parses churn configuration from the runtime
+// environment. Missing params leave churn disabled
+func ChurnConfigFromRuntimeEnv(runenv *runtime.RunEnv) ChurnConfig {
+	if !runenv.IsParamSet("churn_rate") {
+		return ChurnConfig{}
+	}
+	cfg := ChurnConfig{
+		Rate:        runenv.FloatParam("churn_rate"),
+		Interval:    time.Duration(runenv.IntParam("churn_interval_ms")) * time.Millisecond,
+		MinDowntime: time.Duration(runenv.IntParam("churn_downtime_min_ms")) * time.Millisecond,
+		MaxDowntime: time.Duration(runenv.IntParam("churn_downtime_max_ms")) * time.Millisecond,
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = time.Second
+	}
+	if cfg.MinDowntime < 0 {
+		cfg.MinDowntime = 0
+	}
+	if cfg.MaxDowntime < cfg.MinDowntime {
+		cfg.MaxDowntime = cfg.MinDowntime
+	}
+	return cfg
+}
+
+// Enabled reports whether churn is configured
+func (c ChurnConfig) Enabled() bool {
+	return c.Rate > 0
+}
+
+// Churner periodically takes a plan instance off the network & brings it back
+// while the plan runs. With a testground sidecar the instance's network link
+// is disabled, without one all of the actor's peer connections are closed
+type Churner struct {
+	plan   *Plan
+	cfg    ChurnConfig
+	rand   *rand.Rand
+	cancel context.CancelFunc
+	doneCh chan struct{}
+
+	events   int
+	downtime time.Duration
+
+	startAttempted, startSucceeded int
+}
+
+// StartChurn begins churning this instance's network in the background. It's
+// safe to call when churn is disabled, the returned churner does nothing.
+// callers must call Stop once the churned section of the plan is over
+func (plan *Plan) StartChurn(ctx context.Context) *Churner {
+	ctx, cancel := context.WithCancel(ctx)
+	c := &Churner{
+		plan: plan,
+		cfg:  plan.Cfg.Churn,
+		// seeding by sequence number makes churn reproducible across runs
+		rand:   rand.New(rand.NewSource(plan.Seq)),
+		cancel: cancel,
+		doneCh: make(chan struct{}),
+	}
+	c.startAttempted, c.startSucceeded = plan.transfers.counts()
+
+	if !c.cfg.Enabled() {
+		close(c.doneCh)
+		return c
+	}
+
+	plan.Runenv.RecordMessage("starting network churn: %#v", c.cfg)
+	go c.run(ctx)
+	return c
+}
+
+func (c *Churner) run(ctx context.Context) {
+	defer close(c.doneCh)
+	ticker := time.NewTicker(c.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if c.rand.Float64() >= c.cfg.Rate {
+				continue
+			}
+			if err := c.churn(ctx); err != nil {
+				c.plan.Runenv.RecordMessage("churn error: %s", err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// churn takes the instance offline for a random downtime, then restores it
+func (c *Churner) churn(ctx context.Context) error {
+	downtime := c.cfg.MinDowntime
+	if spread := c.cfg.MaxDowntime - c.cfg.MinDowntime; spread > 0 {
+		downtime += time.Duration(c.rand.Int63n(int64(spread)))
+	}
+
+	c.events++
+	c.plan.Runenv.RecordMessage("churn: going offline for %s", downtime)
+	if err := c.plan.setOnline(ctx, false, c.plan.onlineState("churn", c.events, false)); err != nil {
+		return err
+	}
+
+	start := time.Now()
+	select {
+	case <-time.After(downtime):
+	case <-ctx.Done():
+	}
+	c.downtime += time.Since(start)
+
+	// always come back online, even if churn has been stopped
+	c.plan.Runenv.RecordMessage("churn: back online")
+	return c.plan.setOnline(context.Background(), true, c.plan.onlineState("churn", c.events, true))
+}
+
+// Stop ends churn, waits for the instance to be back online & records churn
+// metrics. It returns the number of times the instance went offline
+func (c *Churner) Stop() int {
+	c.cancel()
+	<-c.doneCh
+	if !c.cfg.Enabled() {
+		return 0
+	}
+
+	attempted, succeeded := c.plan.transfers.counts()
+	attempted -= c.startAttempted
+	succeeded -= c.startSucceeded
+
+	c.plan.Runenv.RecordMessage("churn stopped. went offline %d times, %d of %d transfers survived", c.events, succeeded, attempted)
+	c.plan.RecordPoint(MetricChurnEvents, float64(c.events))
+	c.plan.RecordPoint(MetricChurnDowntime, float64(c.downtime.Milliseconds()))
+	c.plan.RecordPoint(MetricChurnTransfersAttempted, float64(attempted))
+	c.plan.RecordPoint(MetricChurnTransfersSurvived, float64(succeeded))
+	return c.events
+}
@@ -0,0 +1,390 @@
+package plan
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/qri-io/test-plans/sim"
+	"github.com/testground/sdk-go/sync"
+)
+
+// connGraphCoordinator is the sequence number of the instance that merges
+// connection snapshots into a graph
+const connGraphCoordinator = 1
+
+// defaultConnSnapshotTimeout is how long the coordinator waits for snapshots
+// of a phase unless the conn_snapshot_timeout_sec param is set
+const defaultConnSnapshotTimeout = time.Minute
+
+// PhaseConnSnapshot is a connection snapshot taken by an instance at a named
+// phase of a test case
+type PhaseConnSnapshot struct {
+	Phase    string
+	Peername string
+	Role     string
+	*sim.ConnSnapshot
+}
+
+// ConnSnapshotTopic carries every connection snapshot from every instance
+var ConnSnapshotTopic = sync.NewTopic("conn-snapshot", &PhaseConnSnapshot{})
+
+// SnapshotConnections records & publishes the connections the actor's libp2p
+// host holds at a phase of the test. Every instance should snapshot the same
+// phases: the coordinating instance waits for a snapshot from each, merges
+// them into a graph of the run & writes it to conn_graph_<phase>.dot &
+// .graphml output files. A coordinator that doesn't hear from every instance
+// within Cfg.ConnSnapshotTimeout, or before ctx is done, writes the partial
+// graph
+func (plan *Plan) SnapshotConnections(ctx context.Context, phase string) error {
+	snap := &PhaseConnSnapshot{
+		Phase:        phase,
+		Peername:     plan.Actor.Peername(),
+		Role:         plan.Role(),
+		ConnSnapshot: plan.Actor.Connections(),
+	}
+	plan.Runenv.RecordMessage("%s: connected to %d peers", phase, len(snap.Conns))
+	plan.RecordPoint(MetricPeersConnected, float64(len(snap.Conns)), "phase", phase)
+	if _, err := plan.Client.Publish(ctx, ConnSnapshotTopic, snap); err != nil {
+		return fmt.Errorf("publishing connection snapshot: %w", err)
+	}
+
+	if plan.Seq != connGraphCoordinator {
+		return nil
+	}
+	snaps, collectErr := plan.collectConnSnapshots(ctx, phase)
+	g := plan.newConnGraph(phase, snaps)
+	if err := plan.writeConnGraph(g); err != nil {
+		return err
+	}
+	return collectErr
+}
+
+// collectConnSnapshots receives a snapshot of phase from every instance. if
+// the snapshot timeout passes or ctx ends first, it returns the snapshots
+// received so far & an error, so a crashed instance can't hold up the
+// coordinator until the run times out
+func (plan *Plan) collectConnSnapshots(ctx context.Context, phase string) ([]*PhaseConnSnapshot, error) {
+	ch := make(chan *PhaseConnSnapshot)
+	sub, err := plan.Client.Subscribe(ctx, ConnSnapshotTopic, ch)
+	if err != nil {
+		return nil, fmt.Errorf("connection snapshot subscription failure: %w", err)
+	}
+	timeout := time.After(plan.Cfg.ConnSnapshotTimeout)
+
+	var snaps []*PhaseConnSnapshot
+	for len(snaps) < plan.Runenv.TestInstanceCount {
+		select {
+		case snap := <-ch:
+			if snap.Phase == phase {
+				snaps = append(snaps, snap)
+			}
+		case err := <-sub.Done():
+			return snaps, err
+		case <-timeout:
+			return snaps, fmt.Errorf("received %d of %d %q connection snapshots within %s", len(snaps), plan.Runenv.TestInstanceCount, phase, plan.Cfg.ConnSnapshotTimeout)
+		case <-ctx.Done():
+			return snaps, fmt.Errorf("received %d of %d %q connection snapshots: %w", len(snaps), plan.Runenv.TestInstanceCount, phase, ctx.Err())
+		}
+	}
+	return snaps, nil
+}
+
+// ConnGraph is the merged connection graph of a run at one phase
+type ConnGraph struct {
+	Phase    string
+	Topology TopologyKind
+	Nodes    []*ConnNode
+	Edges    []*ConnEdge
+}
+
+// ConnNode is a peer in a connection graph. Peers that aren't instances of
+// the run are External
+type ConnNode struct {
+	PeerID   string
+	Seq      int64
+	Peername string
+	Role     string
+	External bool
+	// Protocols lists the protocols other peers learned the node supports
+	Protocols []string
+}
+
+// Connection edge statuses, comparing connections with the topology
+const (
+	// ConnExpected edges are connected & in the topology
+	ConnExpected = "expected"
+	// ConnExtra edges are connected but not in the topology
+	ConnExtra = "extra"
+	// ConnMissing edges are in the topology but not connected
+	ConnMissing = "missing"
+)
+
+// ConnEdge is a connection between two peers. From dialed To if the
+// direction is known
+type ConnEdge struct {
+	From, To string
+	// Directed is false if neither side knows who dialed
+	Directed bool
+	// FromReported & ToReported are true if each side's snapshot holds the
+	// connection. an edge only one side reports is half-open
+	FromReported, ToReported bool
+	Streams                  []string
+	Status                   string
+}
+
+// newConnGraph merges snapshots, comparing connections between instances with
+// the configured topology
+func (plan *Plan) newConnGraph(phase string, snaps []*PhaseConnSnapshot) *ConnGraph {
+	g := &ConnGraph{Phase: phase}
+	nodes := map[string]*ConnNode{}
+	seqPeers := map[int64]string{}
+	for _, s := range snaps {
+		nodes[s.PeerID] = &ConnNode{PeerID: s.PeerID, Seq: s.Seq, Peername: s.Peername, Role: s.Role}
+		seqPeers[s.Seq] = s.PeerID
+	}
+
+	edges := map[[2]string]*ConnEdge{}
+	edgeFor := func(a, b string) *ConnEdge {
+		key := [2]string{a, b}
+		if b < a {
+			key = [2]string{b, a}
+		}
+		if e, ok := edges[key]; ok {
+			return e
+		}
+		e := &ConnEdge{From: key[0], To: key[1], Status: ConnExtra}
+		edges[key] = e
+		return e
+	}
+
+	for _, s := range snaps {
+		for _, c := range s.Conns {
+			if _, ok := nodes[c.PeerID]; !ok {
+				nodes[c.PeerID] = &ConnNode{PeerID: c.PeerID, External: true}
+			}
+			nodes[c.PeerID].Protocols = mergeStrings(nodes[c.PeerID].Protocols, c.Protocols)
+			e := edgeFor(s.PeerID, c.PeerID)
+			if !e.Directed && c.Direction != "unknown" {
+				e.Directed = true
+				if (c.Direction == "outbound") != (e.From == s.PeerID) {
+					e.From, e.To = e.To, e.From
+					e.FromReported, e.ToReported = e.ToReported, e.FromReported
+				}
+			}
+			if e.From == s.PeerID {
+				e.FromReported = true
+			} else {
+				e.ToReported = true
+			}
+			e.Streams = mergeStrings(e.Streams, c.Streams)
+		}
+	}
+
+	if topo, err := plan.Topology(); err != nil {
+		plan.Runenv.RecordMessage("connection graph can't be compared with the topology: %s", err)
+	} else {
+		g.Topology = topo.Kind
+		for seq, a := range seqPeers {
+			for _, n := range topo.Neighbors(seq) {
+				b, ok := seqPeers[n]
+				if !ok || n < seq {
+					continue
+				}
+				key := [2]string{a, b}
+				if b < a {
+					key = [2]string{b, a}
+				}
+				if e, ok := edges[key]; ok {
+					e.Status = ConnExpected
+					continue
+				}
+				edges[key] = &ConnEdge{From: b, To: a, Status: ConnMissing}
+			}
+		}
+	}
+
+	for _, n := range nodes {
+		g.Nodes = append(g.Nodes, n)
+	}
+	sort.Slice(g.Nodes, func(i, j int) bool {
+		if g.Nodes[i].External != g.Nodes[j].External {
+			return !g.Nodes[i].External
+		}
+		if g.Nodes[i].Seq != g.Nodes[j].Seq {
+			return g.Nodes[i].Seq < g.Nodes[j].Seq
+		}
+		return g.Nodes[i].PeerID < g.Nodes[j].PeerID
+	})
+	for _, e := range edges {
+		g.Edges = append(g.Edges, e)
+	}
+	sort.Slice(g.Edges, func(i, j int) bool {
+		if g.Edges[i].From != g.Edges[j].From {
+			return g.Edges[i].From < g.Edges[j].From
+		}
+		return g.Edges[i].To < g.Edges[j].To
+	})
+	return g
+}
+
+// mergeStrings adds the members of b missing from a, keeping a sorted
+func mergeStrings(a, b []string) []string {
+	for _, s := range b {
+		i := sort.SearchStrings(a, s)
+		if i < len(a) && a[i] == s {
+			continue
+		}
+		a = append(a, "")
+		copy(a[i+1:], a[i:])
+		a[i] = s
+	}
+	return a
+}
+
+func (plan *Plan) writeConnGraph(g *ConnGraph) error {
+	name := "conn_graph_" + strings.ReplaceAll(g.Phase, " ", "_")
+	for ext, write := range map[string]func(io.Writer) error{
+		".dot":     g.WriteDOT,
+		".graphml": g.WriteGraphML,
+	} {
+		f, err := plan.Runenv.CreateRawAsset(name + ext)
+		if err != nil {
+			return err
+		}
+		if err := write(f); err != nil {
+			f.Close()
+			return fmt.Errorf("writing %s%s: %w", name, ext, err)
+		}
+		if err := f.Close(); err != nil {
+			return err
+		}
+	}
+	plan.Runenv.RecordMessage("wrote %q connection graph of %d nodes & %d edges", g.Phase, len(g.Nodes), len(g.Edges))
+	return nil
+}
+
+// label describes a node for humans
+func (n *ConnNode) label() string {
+	if n.External {
+		return "external\n" + shortPeerID(n.PeerID)
+	}
+	label := fmt.Sprintf("seq %d\n%s", n.Seq, n.Peername)
+	if n.Role != "" {
+		label += "\n" + n.Role
+	}
+	return label
+}
+
+// reported describes which sides of an edge hold the connection
+func (e *ConnEdge) reported() string {
+	switch {
+	case e.FromReported && e.ToReported:
+		return "both"
+	case e.FromReported:
+		return "from"
+	case e.ToReported:
+		return "to"
+	}
+	return "none"
+}
+
+func shortPeerID(id string) string {
+	if len(id) > 8 {
+		return id[len(id)-8:]
+	}
+	return id
+}
+
+// WriteDOT writes the graph in graphviz DOT format. edges point from the
+// dialer. edges missing from the topology are blue, topology edges that aren't
+// connected are dotted red & connections only one side reports are dashed
+func (g *ConnGraph) WriteDOT(w io.Writer) error {
+	b := &strings.Builder{}
+	fmt.Fprintf(b, "digraph %q {\n", "connections "+g.Phase)
+	fmt.Fprintf(b, "  label=%q;\n  node [shape=box];\n", fmt.Sprintf("%s connections, %s topology", g.Phase, g.Topology))
+	for _, n := range g.Nodes {
+		style := ""
+		if n.External {
+			style = ", style=dashed"
+		}
+		fmt.Fprintf(b, "  %q [label=%q%s];\n", n.PeerID, n.label(), style)
+	}
+	for _, e := range g.Edges {
+		attrs := []string{fmt.Sprintf("label=%q", strings.Join(e.Streams, "\n"))}
+		switch e.Status {
+		case ConnMissing:
+			attrs = append(attrs, "color=red", "style=dotted", "dir=none")
+		case ConnExtra:
+			attrs = append(attrs, "color=blue")
+		}
+		if e.Status != ConnMissing {
+			if !e.Directed {
+				attrs = append(attrs, "dir=none")
+			}
+			if e.reported() != "both" {
+				attrs = append(attrs, "style=dashed")
+			}
+		}
+		fmt.Fprintf(b, "  %q -> %q [%s];\n", e.From, e.To, strings.Join(attrs, ", "))
+	}
+	b.WriteString("}\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// WriteGraphML writes the graph in GraphML format, with node & edge details as
+// data attributes
+func (g *ConnGraph) WriteGraphML(w io.Writer) error {
+	b := &strings.Builder{}
+	b.WriteString(xml.Header)
+	b.WriteString(`<graphml xmlns="http://graphml.graphdrawing.org/xmlns">` + "\n")
+	for _, k := range []struct{ id, domain, typ string }{
+		{"seq", "node", "long"},
+		{"peername", "node", "string"},
+		{"role", "node", "string"},
+		{"external", "node", "boolean"},
+		{"protocols", "node", "string"},
+		{"directed", "edge", "boolean"},
+		{"reported", "edge", "string"},
+		{"streams", "edge", "string"},
+		{"status", "edge", "string"},
+	} {
+		fmt.Fprintf(b, `  <key id="%s" for="%s" attr.name="%s" attr.type="%s"/>`+"\n", k.id, k.domain, k.id, k.typ)
+	}
+	fmt.Fprintf(b, `  <graph id="%s" edgedefault="directed">`+"\n", escapeXML(g.Phase))
+	for _, n := range g.Nodes {
+		fmt.Fprintf(b, `    <node id="%s">`, escapeXML(n.PeerID))
+		writeGraphMLData(b, "seq", fmt.Sprintf("%d", n.Seq))
+		writeGraphMLData(b, "peername", n.Peername)
+		writeGraphMLData(b, "role", n.Role)
+		writeGraphMLData(b, "external", fmt.Sprintf("%t", n.External))
+		writeGraphMLData(b, "protocols", strings.Join(n.Protocols, " "))
+		b.WriteString("</node>\n")
+	}
+	for i, e := range g.Edges {
+		fmt.Fprintf(b, `    <edge id="e%d" source="%s" target="%s">`, i, escapeXML(e.From), escapeXML(e.To))
+		writeGraphMLData(b, "directed", fmt.Sprintf("%t", e.Directed))
+		writeGraphMLData(b, "reported", e.reported())
+		writeGraphMLData(b, "streams", strings.Join(e.Streams, " "))
+		writeGraphMLData(b, "status", e.Status)
+		b.WriteString("</edge>\n")
+	}
+	b.WriteString("  </graph>\n</graphml>\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func writeGraphMLData(b *strings.Builder, key, value string) {
+	fmt.Fprintf(b, `<data key="%s">%s</data>`, key, escapeXML(value))
+}
+
+func escapeXML(s string) string {
+	b := &strings.Builder{}
+	xml.EscapeText(b, []byte(s))
+	return b.String()
+}
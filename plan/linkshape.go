@@ -0,0 +1,170 @@
+package plan
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/testground/sdk-go/network"
+	"github.com/testground/sdk-go/runtime"
+	"github.com/testground/sdk-go/sync"
+)
+
+// LinkShapeParams is a partial link shape read from JSON test params. Fields
+// that aren't set keep the value of the link shape they're applied to
+type LinkShapeParams struct {
+	LatencyMS   *int     `json:"latency,omitempty"`
+	JitterMS    *int     `json:"jitter,omitempty"`
+	BandwidthMB *int     `json:"bandwidth_mb,omitempty"`
+	Loss        *float32 `json:"loss,omitempty"`
+	Corrupt     *float32 `json:"corrupt,omitempty"`
+	Duplicate   *float32 `json:"duplicate,omitempty"`
+	Reorder     *float32 `json:"reorder,omitempty"`
+}
+
+// Apply overrides fields of base with any fields set in p
+func (p LinkShapeParams) Apply(base network.LinkShape) network.LinkShape {
+	if p.LatencyMS != nil {
+		base.Latency = time.Duration(*p.LatencyMS) * time.Millisecond
+	}
+	if p.JitterMS != nil {
+		base.Jitter = time.Duration(*p.JitterMS) * time.Millisecond
+	}
+	if p.BandwidthMB != nil {
+		base.Bandwidth = uint64(*p.BandwidthMB) << 20
+	}
+	if p.Loss != nil {
+		base.Loss = *p.Loss
+	}
+	if p.Corrupt != nil {
+		base.Corrupt = *p.Corrupt
+	}
+	if p.Duplicate != nil {
+		base.Duplicate = *p.Duplicate
+	}
+	if p.Reorder != nil {
+		base.Reorder = *p.Reorder
+	}
+	return base
+}
+
+// LinkRuleParams shapes egress traffic to a subset of peers, selected either
+// by role or by subnet in CIDR notation. Exactly one of Role & Subnet must be
+// set
+type LinkRuleParams struct {
+	Role   string `json:"role,omitempty"`
+	Subnet string `json:"subnet,omitempty"`
+	LinkShapeParams
+}
+
+// linkShapeParams reads the role_link_shapes & link_rules params. Both are
+// JSON, role_link_shapes maps role names to the egress shape of instances with
+// that role:
+//
+//	{"remote": {"bandwidth_mb": 100}, "pusher": {"bandwidth_mb": 1, "latency": 50}}
+//
+// link_rules is a list of shapes applied to traffic headed to a role or subnet:
+//
+//	[{"role": "remote", "loss": 2}, {"subnet": "16.0.0.0/16", "jitter": 10}]
+func linkShapeParams(runenv *runtime.RunEnv) (roleShapes map[string]LinkShapeParams, rules []LinkRuleParams) {
+	if runenv.IsParamSet("role_link_shapes") {
+		runenv.JSONParam("role_link_shapes", &roleShapes)
+	}
+	if runenv.IsParamSet("link_rules") {
+		runenv.JSONParam("link_rules", &rules)
+	}
+	return roleShapes, rules
+}
+
+// RoleLinkShape returns the default egress link shape for an instance with
+// the given role
+func (cfg *PlanConfig) RoleLinkShape(role string) network.LinkShape {
+	shape := cfg.LinkShape()
+	if p, ok := cfg.RoleLinkShapes[role]; ok {
+		shape = p.Apply(shape)
+	}
+	return shape
+}
+
+// instanceAddr pairs an instance sequence number with its data network IP
+type instanceAddr struct {
+	Seq int64
+	IP  string
+}
+
+var instanceAddrTopic = sync.NewTopic("instance-addr", &instanceAddr{})
+
+// resolveLinkRules turns the configured link rules into network rules. Role
+// rules are resolved to the data network IP of each member of the role in
+// ips. Roles must be assigned before calling resolveLinkRules
+func (plan *Plan) resolveLinkRules(ips map[int64]net.IP) ([]network.LinkRule, error) {
+	var rules []network.LinkRule
+	for _, r := range plan.Cfg.LinkRules {
+		switch {
+		case r.Role != "" && r.Subnet != "":
+			return nil, fmt.Errorf("link rule can't set both role %q and subnet %q", r.Role, r.Subnet)
+		case r.Subnet != "":
+			_, subnet, err := net.ParseCIDR(r.Subnet)
+			if err != nil {
+				return nil, fmt.Errorf("parsing link rule subnet: %w", err)
+			}
+			rules = append(rules, network.LinkRule{
+				Subnet:    *subnet,
+				LinkShape: r.Apply(plan.networkDefaultShape()),
+			})
+		case r.Role != "":
+			if plan.Roles == nil {
+				return nil, fmt.Errorf("link rule for role %q requires roles to be assigned before setting up the network", r.Role)
+			}
+			for _, seq := range plan.Roles.Members(r.Role) {
+				if seq == plan.Seq {
+					continue
+				}
+				rules = append(rules, network.LinkRule{
+					Subnet:    net.IPNet{IP: ips[seq], Mask: net.CIDRMask(32, 32)},
+					LinkShape: r.Apply(plan.networkDefaultShape()),
+				})
+			}
+		default:
+			return nil, fmt.Errorf("link rule must set either a role or a subnet")
+		}
+	}
+	return rules, nil
+}
+
+// exchangeAddrs publishes this instance's data network IP & collects the IP
+// of every instance in the run, keyed by sequence number
+func (plan *Plan) exchangeAddrs(ctx context.Context, netclient *network.Client) (map[int64]net.IP, error) {
+	ip, err := netclient.GetDataNetworkIP()
+	if err != nil {
+		return nil, err
+	}
+
+	ch := make(chan *instanceAddr)
+	_, sub, err := plan.Client.PublishSubscribe(ctx, instanceAddrTopic, &instanceAddr{
+		Seq: plan.Seq,
+		IP:  ip.String(),
+	}, ch)
+	if err != nil {
+		return nil, fmt.Errorf("sharing instance address: %w", err)
+	}
+
+	ips := make(map[int64]net.IP, plan.Runenv.TestInstanceCount)
+	for len(ips) < plan.Runenv.TestInstanceCount {
+		select {
+		case ia := <-ch:
+			ips[ia.Seq] = net.ParseIP(ia.IP).To4()
+		case err := <-sub.Done():
+			return nil, err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	return ips, nil
+}
+
+// networkDefaultShape is the egress link shape for this instance's role
+func (plan *Plan) networkDefaultShape() network.LinkShape {
+	return plan.Cfg.RoleLinkShape(plan.Role())
+}
@@ -0,0 +1,177 @@
+package plan
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	gosync "sync"
+	"time"
+
+	"github.com/qri-io/test-plans/sim"
+)
+
+// Result metric names recorded for each transfer between an actor and a
+// remote. All transfer metrics are tagged with "remote", plus the standard
+// plan tags. push_bytes & pull_bytes are the size of the transferred version's
+// DAG, not the bytes sent over the wire, see the bandwidth metrics for those
+const (
+	MetricPushDuration = "push_duration_ms"
+	MetricPushBytes    = "push_bytes"
+	MetricPushBlocks   = "push_blocks"
+	MetricPushSuccess  = "push_success"
+	MetricPullDuration = "pull_duration_ms"
+	MetricPullBytes    = "pull_bytes"
+	MetricPullBlocks   = "pull_blocks"
+	MetricPullSuccess  = "pull_success"
+
+	// MetricLogbookBytes is the size of an actor's logbook on disk
+	MetricLogbookBytes = "logbook_bytes"
+
+	// MetricPeersConnected is the number of peers an actor's host is
+	// connected to, tagged with "phase"
+	MetricPeersConnected = "peers_connected"
+
+	// bandwidth metrics are bytes an actor's host sent or received during a
+	// phase, tagged with "phase" & "direction". protocol bytes are also
+	// tagged with "protocol" & "family", peer bytes with "peer"
+	MetricBandwidthTotalBytes    = "bandwidth_total_bytes"
+	MetricBandwidthProtocolBytes = "bandwidth_protocol_bytes"
+	MetricBandwidthPeerBytes     = "bandwidth_peer_bytes"
+
+	// dataset metrics describe a generated dataset's head version, tagged
+	// with "dataset"
+	MetricDatasetBodyBytes = "dataset_body_bytes"
+	MetricDatasetBodyRows  = "dataset_body_rows"
+	MetricDatasetBlocks    = "dataset_blocks"
+	MetricDatasetDAGBytes  = "dataset_dag_bytes"
+)
+
+// MetricName formats a metric name with tags in the "name,key=value" form the
+// testground sdk splits into InfluxDB tags. tags are sorted by key so the
+// same set of tags always produces the same name
+func MetricName(name string, tags map[string]string) string {
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	b := strings.Builder{}
+	b.WriteString(name)
+	for _, k := range keys {
+		b.WriteString(fmt.Sprintf(",%s=%s", k, tags[k]))
+	}
+	return b.String()
+}
+
+// MetricTags returns the standard tags for metrics recorded by this plan
+// instance: role, dataset shape, size (in bytes or rows), versions & link
+// latency, plus any extra tags given as alternating keys & values
+func (plan *Plan) MetricTags(kv ...string) map[string]string {
+	tags := map[string]string{
+		"latency": fmt.Sprintf("%d", plan.Cfg.Latency.Milliseconds()),
+	}
+	if role := plan.Role(); role != "" {
+		tags["role"] = role
+	}
+	if plan.Cfg.DatasetBytes > 0 {
+		tags["bytes"] = fmt.Sprintf("%d", plan.Cfg.DatasetBytes)
+	} else if plan.Cfg.DatasetRows > 0 {
+		tags["rows"] = fmt.Sprintf("%d", plan.Cfg.DatasetRows)
+	}
+	if plan.Cfg.DatasetShape != "" {
+		tags["shape"] = plan.Cfg.DatasetShape
+	}
+	if plan.Cfg.DatasetVersions > 0 {
+		tags["versions"] = fmt.Sprintf("%d", plan.Cfg.DatasetVersions)
+	}
+	for i := 0; i+1 < len(kv); i += 2 {
+		tags[kv[i]] = kv[i+1]
+	}
+	return tags
+}
+
+// RecordPoint records a result metric with the standard plan tags. extra tags
+// are given as alternating keys & values
+func (plan *Plan) RecordPoint(name string, value float64, kv ...string) {
+	plan.Runenv.R().RecordPoint(MetricName(name, plan.MetricTags(kv...)), value)
+}
+
+// transferMetrics names the metrics recorded for one kind of transfer
+type transferMetrics struct {
+	duration, bytes, blocks, success string
+}
+
+var (
+	pushMetrics = transferMetrics{MetricPushDuration, MetricPushBytes, MetricPushBlocks, MetricPushSuccess}
+	pullMetrics = transferMetrics{MetricPullDuration, MetricPullBytes, MetricPullBlocks, MetricPullSuccess}
+)
+
+// transferCounts tallies transfers, safe for concurrent use
+type transferCounts struct {
+	lk                   gosync.Mutex
+	attempted, succeeded int
+}
+
+func (t *transferCounts) add(success bool) {
+	t.lk.Lock()
+	defer t.lk.Unlock()
+	t.attempted++
+	if success {
+		t.succeeded++
+	}
+}
+
+func (t *transferCounts) counts() (attempted, succeeded int) {
+	t.lk.Lock()
+	defer t.lk.Unlock()
+	return t.attempted, t.succeeded
+}
+
+// recordTransfer records metrics for a single push or pull of the dataset
+// version at path. Byte & block counts are only recorded for successful
+// transfers
+func (plan *Plan) recordTransfer(ctx context.Context, m transferMetrics, remote string, took time.Duration, path string, transferErr error) {
+	plan.transfers.add(transferErr == nil)
+	plan.RecordPoint(m.duration, float64(took.Milliseconds()), "remote", remote)
+	if transferErr != nil {
+		plan.RecordPoint(m.success, 0, "remote", remote)
+		return
+	}
+	plan.RecordPoint(m.success, 1, "remote", remote)
+
+	blocks, size, err := plan.Actor.DAGSize(ctx, path)
+	if err != nil {
+		plan.Runenv.RecordMessage("error calculating size of %q: %s", path, err)
+		return
+	}
+	plan.RecordPoint(m.blocks, float64(blocks), "remote", remote)
+	plan.RecordPoint(m.bytes, float64(size), "remote", remote)
+}
+
+// RecordLogbookSize records the size of the actor's logbook
+func (plan *Plan) RecordLogbookSize() {
+	size, err := plan.Actor.LogbookSize()
+	if err != nil {
+		plan.Runenv.RecordMessage("error reading logbook size: %s", err)
+		return
+	}
+	plan.RecordPoint(MetricLogbookBytes, float64(size))
+}
+
+// RecordDatasetStats records the body size, block count & root CID of the
+// head version of one of act's datasets. act is passed explicitly so actor
+// constructors can record stats before plan.Actor is set
+func (plan *Plan) RecordDatasetStats(ctx context.Context, act *sim.Actor, name string) error {
+	stats, err := act.DatasetStats(ctx, name)
+	if err != nil {
+		return err
+	}
+	plan.Runenv.RecordMessage("dataset %s: root %s, %d body bytes, %d rows, %d blocks, %d DAG bytes", name, stats.Path, stats.BodyBytes, stats.BodyRows, stats.Blocks, stats.DAGBytes)
+	plan.RecordPoint(MetricDatasetBodyBytes, float64(stats.BodyBytes), "dataset", name)
+	plan.RecordPoint(MetricDatasetBodyRows, float64(stats.BodyRows), "dataset", name)
+	plan.RecordPoint(MetricDatasetBlocks, float64(stats.Blocks), "dataset", name)
+	plan.RecordPoint(MetricDatasetDAGBytes, float64(stats.DAGBytes), "dataset", name)
+	return nil
+}
@@ -0,0 +1,61 @@
+package plan
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/testground/sdk-go/network"
+	"github.com/testground/sdk-go/sync"
+)
+
+// Interrupt takes this instance off the network for downtime, then brings it
+// back online. It's useful for cutting off a transfer that's in progress
+func (plan *Plan) Interrupt(ctx context.Context, downtime time.Duration) error {
+	plan.interrupts++
+	plan.Runenv.RecordMessage("interrupt: going offline for %s", downtime)
+	if err := plan.setOnline(ctx, false, plan.onlineState("interrupt", plan.interrupts, false)); err != nil {
+		return err
+	}
+
+	select {
+	case <-time.After(downtime):
+	case <-ctx.Done():
+	}
+
+	// always come back online, even if the context is done
+	plan.Runenv.RecordMessage("interrupt: back online")
+	return plan.setOnline(context.Background(), true, plan.onlineState("interrupt", plan.interrupts, true))
+}
+
+// setOnline connects or disconnects this instance from the network. With a
+// testground sidecar the instance's network link is toggled, without one
+// going offline closes all of the actor's peer connections. state must be
+// unique to this change
+func (plan *Plan) setOnline(ctx context.Context, online bool, state sync.State) error {
+	if !plan.Runenv.TestSidecar {
+		if online {
+			// peers reconnect on demand, nothing to do
+			return nil
+		}
+		host := plan.Actor.Inst.Node().Host()
+		for _, pid := range host.Network().Peers() {
+			if err := host.Network().ClosePeer(pid); err != nil {
+				plan.Runenv.RecordMessage("closing connection to %s: %s", pid.Pretty(), err)
+			}
+		}
+		return nil
+	}
+
+	cfg := plan.networkConfig()
+	cfg.Enable = online
+	// only this instance needs to apply the change
+	cfg.CallbackState = state
+	cfg.CallbackTarget = 1
+	return network.NewClient(plan.Client, plan.Runenv).ConfigureNetwork(ctx, &cfg)
+}
+
+// onlineState generates a sync state unique to one network change
+func (plan *Plan) onlineState(kind string, event int, online bool) sync.State {
+	return sync.State(fmt.Sprintf("%s-%d-%d-%t", kind, plan.Seq, event, online))
+}
@@ -0,0 +1,186 @@
+package plan
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	p2pnet "github.com/libp2p/go-libp2p-core/network"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/testground/sdk-go/network"
+	"github.com/testground/sdk-go/sync"
+)
+
+// Partition divides instances into groups that can't reach one another. Each
+// group is a list of instance sequence numbers. Instances that aren't listed
+// in any group form one extra group
+type Partition [][]int64
+
+// SplitPartition divides total instances into n groups of consecutive
+// sequence numbers, with group sizes differing by at most one
+func SplitPartition(total, n int) (Partition, error) {
+	if n < 2 || n > total {
+		return nil, fmt.Errorf("can't split %d instances into %d groups", total, n)
+	}
+	p := make(Partition, n)
+	// seq numbers start at 1
+	for seq := int64(1); seq <= int64(total); seq++ {
+		group := int((seq - 1) * int64(n) / int64(total))
+		p[group] = append(p[group], seq)
+	}
+	return p, nil
+}
+
+// RolePartition groups instances by role, each side lists the roles on one
+// side of the partition
+func RolePartition(roles *Roles, sides ...[]string) Partition {
+	p := make(Partition, len(sides))
+	for i, side := range sides {
+		for _, name := range side {
+			p[i] = append(p[i], roles.Members(name)...)
+		}
+	}
+	return p
+}
+
+// GroupOf returns the index of the group seq belongs to
+func (p Partition) GroupOf(seq int64) int {
+	for i, group := range p {
+		for _, s := range group {
+			if s == seq {
+				return i
+			}
+		}
+	}
+	return len(p)
+}
+
+// Reachable reports whether instances a & b are in the same group
+func (p Partition) Reachable(a, b int64) bool {
+	return p.GroupOf(a) == p.GroupOf(b)
+}
+
+// partitionState tracks the partition an instance is currently part of
+type partitionState struct {
+	active Partition
+	// rules drop traffic to unreachable instances when running with a sidecar
+	rules []network.LinkRule
+	// notifiee severs connections to unreachable peers without a sidecar
+	notifiee p2pnet.Notifiee
+}
+
+// PartitionAt waits for every instance to signal state, then cuts this
+// instance off from all instances outside its group. With a testground
+// sidecar traffic to unreachable instances is dropped at the network layer.
+// Without one, connections to unreachable peers are closed as they open,
+// which requires actor info to be shared first
+func (plan *Plan) PartitionAt(ctx context.Context, state sync.State, p Partition) error {
+	plan.Runenv.RecordMessage("waiting to partition at %q", state)
+	if _, err := plan.Client.SignalAndWait(ctx, state, plan.Runenv.TestInstanceCount); err != nil {
+		return err
+	}
+	if plan.partition.active != nil {
+		return fmt.Errorf("network is already partitioned")
+	}
+
+	plan.partition.active = p
+	plan.Runenv.RecordMessage("partitioned into group %d of %d", p.GroupOf(plan.Seq), len(p))
+	if plan.Runenv.TestSidecar {
+		return plan.applyPartitionRules(ctx, state)
+	}
+	return plan.blockPartitionedPeers()
+}
+
+// HealAt waits for every instance to signal state, then removes the active
+// partition
+func (plan *Plan) HealAt(ctx context.Context, state sync.State) error {
+	plan.Runenv.RecordMessage("waiting to heal partition at %q", state)
+	if _, err := plan.Client.SignalAndWait(ctx, state, plan.Runenv.TestInstanceCount); err != nil {
+		return err
+	}
+	if plan.partition.active == nil {
+		return fmt.Errorf("network isn't partitioned")
+	}
+
+	plan.partition.active = nil
+	plan.Runenv.RecordMessage("healed partition")
+	if plan.Runenv.TestSidecar {
+		return plan.applyPartitionRules(ctx, state)
+	}
+	if plan.partition.notifiee != nil {
+		plan.Actor.Inst.Node().Host().Network().StopNotify(plan.partition.notifiee)
+		plan.partition.notifiee = nil
+	}
+	return nil
+}
+
+// Partitioned reports whether the network is currently partitioned
+func (plan *Plan) Partitioned() bool {
+	return plan.partition.active != nil
+}
+
+// applyPartitionRules reconfigures the network with a rule dropping all
+// traffic to each unreachable instance, waiting for every instance to apply
+// its configuration
+func (plan *Plan) applyPartitionRules(ctx context.Context, state sync.State) error {
+	netclient := network.NewClient(plan.Client, plan.Runenv)
+	if plan.addrs == nil {
+		ips, err := plan.exchangeAddrs(ctx, netclient)
+		if err != nil {
+			return err
+		}
+		plan.addrs = ips
+	}
+
+	plan.partition.rules = nil
+	if p := plan.partition.active; p != nil {
+		for seq, ip := range plan.addrs {
+			if p.Reachable(plan.Seq, seq) {
+				continue
+			}
+			plan.partition.rules = append(plan.partition.rules, network.LinkRule{
+				Subnet: net.IPNet{IP: ip, Mask: net.CIDRMask(32, 32)},
+				LinkShape: network.LinkShape{
+					Filter: network.Drop,
+					Loss:   100,
+				},
+			})
+		}
+	}
+
+	cfg := plan.networkConfig()
+	cfg.CallbackState = sync.State(fmt.Sprintf("%s-network-configured", state))
+	return netclient.ConfigureNetwork(ctx, &cfg)
+}
+
+// blockPartitionedPeers closes all connections to unreachable peers, and
+// keeps closing them for as long as the partition is active
+func (plan *Plan) blockPartitionedPeers() error {
+	if plan.Actor == nil {
+		return fmt.Errorf("partitioning without a sidecar requires a constructed actor")
+	}
+
+	blocked := map[peer.ID]bool{}
+	for _, info := range plan.Others {
+		if !plan.partition.active.Reachable(plan.Seq, int64(info.Seq)) {
+			blocked[info.AddrInfo.ID] = true
+		}
+	}
+
+	host := plan.Actor.Inst.Node().Host()
+	plan.partition.notifiee = &p2pnet.NotifyBundle{
+		ConnectedF: func(_ p2pnet.Network, conn p2pnet.Conn) {
+			if blocked[conn.RemotePeer()] {
+				go conn.Close()
+			}
+		},
+	}
+	host.Network().Notify(plan.partition.notifiee)
+
+	for pid := range blocked {
+		if err := host.Network().ClosePeer(pid); err != nil {
+			plan.Runenv.RecordMessage("partition: closing connection to %s: %s", pid.Pretty(), err)
+		}
+	}
+	return nil
+}
@@ -1,9 +1,9 @@
 package plan
 
 import (
-	"bytes"
 	"context"
 	"fmt"
+	"net"
 	"time"
 
 	"github.com/libp2p/go-libp2p-core/peer"
@@ -19,13 +19,104 @@ import (
 type PlanConfig struct {
 	Timeout time.Duration
 	Latency time.Duration
+	// Bandwidth is egress bytes per second
+	Bandwidth uint64
+	Jitter    time.Duration
+	// Loss, Corrupt, Duplicate & Reorder are egress packet percentages
+	Loss      float32
+	Corrupt   float32
+	Duplicate float32
+	Reorder   float32
+	// RoleLinkShapes overrides the link shape of instances by role
+	RoleLinkShapes map[string]LinkShapeParams
+	// LinkRules shapes traffic headed to specific roles or subnets
+	LinkRules []LinkRuleParams
+	// DatasetRows is the number of rows in generated datasets, if the test
+	// case sets it
+	DatasetRows int
+	// DatasetBytes is the target body size of generated datasets, if the test
+	// case sets it. it takes precedence over DatasetRows
+	DatasetBytes int64
+	// DatasetVersions is the length of generated dataset histories, if the
+	// test case sets it
+	DatasetVersions int
+	// DatasetShape names the generator for dataset bodies, if the test case
+	// sets it
+	DatasetShape string
+	// Churn configures periodic network disconnects, disabled by default
+	Churn ChurnConfig
+	// Topology selects which peers DialOtherPeers connects, a full mesh by
+	// default
+	Topology TopologyConfig
+	// ConnSnapshotTimeout bounds how long the coordinator waits for every
+	// instance's connection snapshot of a phase
+	ConnSnapshotTimeout time.Duration
 }
 
 // PlanConfigFromRuntimeEnv parses configuration from the runtime environment
 func PlanConfigFromRuntimeEnv(runenv *runtime.RunEnv) *PlanConfig {
-	return &PlanConfig{
-		Timeout: time.Duration(runenv.IntParam("timeout_secs")) * time.Second,
-		Latency: time.Duration(runenv.IntParam("latency")) * time.Millisecond,
+	cfg := &PlanConfig{
+		Timeout:   time.Duration(runenv.IntParam("timeout_secs")) * time.Second,
+		Latency:   time.Duration(runenv.IntParam("latency")) * time.Millisecond,
+		Bandwidth: defaultBandwidth,
+		Churn:     ChurnConfigFromRuntimeEnv(runenv),
+		Topology:  TopologyConfigFromRuntimeEnv(runenv),
+
+		ConnSnapshotTimeout: defaultConnSnapshotTimeout,
+	}
+
+	if runenv.IsParamSet("bandwidth_mb") {
+		cfg.Bandwidth = uint64(runenv.IntParam("bandwidth_mb")) << 20
+	}
+	if runenv.IsParamSet("jitter") {
+		cfg.Jitter = time.Duration(runenv.IntParam("jitter")) * time.Millisecond
+	}
+	cfg.Loss = percentParam(runenv, "loss")
+	cfg.Corrupt = percentParam(runenv, "corrupt")
+	cfg.Duplicate = percentParam(runenv, "duplicate")
+	cfg.Reorder = percentParam(runenv, "reorder")
+	cfg.RoleLinkShapes, cfg.LinkRules = linkShapeParams(runenv)
+	if runenv.IsParamSet("datasetRows") {
+		cfg.DatasetRows = runenv.IntParam("datasetRows")
+	}
+	if runenv.IsParamSet("datasetBytes") {
+		cfg.DatasetBytes = int64(runenv.IntParam("datasetBytes"))
+	}
+	if runenv.IsParamSet("datasetVersions") {
+		cfg.DatasetVersions = runenv.IntParam("datasetVersions")
+	}
+	if runenv.IsParamSet("datasetShape") {
+		cfg.DatasetShape = runenv.StringParam("datasetShape")
+	}
+	if runenv.IsParamSet("conn_snapshot_timeout_sec") {
+		if secs := runenv.IntParam("conn_snapshot_timeout_sec"); secs > 0 {
+			cfg.ConnSnapshotTimeout = time.Duration(secs) * time.Second
+		}
+	}
+	return cfg
+}
+
+// defaultBandwidth is used when the bandwidth_mb param isn't set
+const defaultBandwidth = 10 << 20 // 10Mib
+
+// percentParam reads a percentage param, defaulting to zero if unset
+func percentParam(runenv *runtime.RunEnv, name string) float32 {
+	if !runenv.IsParamSet(name) {
+		return 0
+	}
+	return float32(runenv.FloatParam(name))
+}
+
+// LinkShape describes how this plan's network link should be shaped
+func (cfg *PlanConfig) LinkShape() network.LinkShape {
+	return network.LinkShape{
+		Latency:   cfg.Latency,
+		Jitter:    cfg.Jitter,
+		Bandwidth: cfg.Bandwidth,
+		Loss:      cfg.Loss,
+		Corrupt:   cfg.Corrupt,
+		Duplicate: cfg.Duplicate,
+		Reorder:   cfg.Reorder,
 	}
 }
 
@@ -38,15 +129,52 @@ type Plan struct {
 	Client    sync.Client
 	finishedC <-chan error
 	Seq       int64
+	// Roles is the role assignment for every instance in the run, set by
+	// AssignRoles or AssignGroupRoles
+	Roles *Roles
+	// transfers counts pushes & pulls this instance has attempted
+	transfers transferCounts
+	// linkRules are resolved from Cfg.LinkRules when the network is set up
+	linkRules []network.LinkRule
+	// addrs maps instance sequence numbers to data network IPs, set when
+	// running with a sidecar
+	addrs map[int64]net.IP
+	// partition is the network partition this instance is part of, if any
+	partition partitionState
+	// assertions collects the outcome of every Assert call
+	assertions assertionResults
+	// interrupts counts calls to Interrupt
+	interrupts int
+	// bandwidth is the reading taken by the last RecordBandwidth call
+	bandwidth *sim.BandwidthStats
 
 	Actor  *sim.Actor
 	Others map[string]*sim.ActorInfo
 }
 
+// RunFunc is a test case, executed once for each plan instance in a run
+type RunFunc func(context.Context, *Plan) error
+
 // NewPlan creates a plan instance from runtime data
 func NewPlan(ctx context.Context, runenv *runtime.RunEnv) *Plan {
-	client := sync.MustBoundClient(ctx, runenv)
+	return NewPlanWithClient(ctx, runenv, sync.MustBoundClient(ctx, runenv))
+}
+
+// NewPlanWithClient creates a plan instance that coordinates with other
+// instances through the given sync client. Every signal entry & barrier the
+// plan's client handles is recorded to the SyncEventsAsset output file
+func NewPlanWithClient(ctx context.Context, runenv *runtime.RunEnv, client sync.Client) *Plan {
+	rec, err := newSyncRecorder(runenv, client)
+	if err != nil {
+		runenv.RecordMessage("error creating sync events file, sync events won't be recorded: %s", err)
+	} else {
+		client = rec
+	}
+
 	seq := client.MustSignalAndWait(ctx, "assign-seq", runenv.TestInstanceCount)
+	if rec != nil {
+		rec.setSeq(seq)
+	}
 
 	return &Plan{
 		Cfg:       PlanConfigFromRuntimeEnv(runenv),
@@ -59,7 +187,8 @@ func NewPlan(ctx context.Context, runenv *runtime.RunEnv) *Plan {
 	}
 }
 
-// SetupNetwork configures the network for plan execution
+// SetupNetwork configures the network for plan execution. Plans that shape
+// links by role must assign roles before setting up the network
 func (plan *Plan) SetupNetwork(ctx context.Context) error {
 	if !plan.Runenv.TestSidecar {
 		return nil
@@ -69,20 +198,6 @@ func (plan *Plan) SetupNetwork(ctx context.Context) error {
 	// 	return err
 	// }
 
-	ntwkCfg := network.Config{
-		// Control the "default" network. At the moment, this is the only network.
-		Network: "default",
-
-		// Enable this network. Setting this to false will disconnect this test
-		// instance from this network. You probably don't want to do that.
-		Enable: true,
-		Default: network.LinkShape{
-			Latency:   plan.Cfg.Latency,
-			Bandwidth: 10 << 20, // 10Mib
-		},
-		CallbackState: "network-configured",
-	}
-
 	// if _, err = plan.Client.Publish(ctx, network.Topic(hostname), &ntwkCfg); err != nil {
 	// 	return err
 	// }
@@ -90,10 +205,44 @@ func (plan *Plan) SetupNetwork(ctx context.Context) error {
 	// return <-plan.Client.MustBarrier(ctx, ntwkCfg.CallbackState, plan.Runenv.TestInstanceCount).C
 	netclient := network.NewClient(plan.Client, plan.Runenv)
 	netclient.MustWaitNetworkInitialized(ctx)
+
+	ips, err := plan.exchangeAddrs(ctx, netclient)
+	if err != nil {
+		return err
+	}
+	plan.addrs = ips
+
+	rules, err := plan.resolveLinkRules(plan.addrs)
+	if err != nil {
+		return err
+	}
+	plan.linkRules = rules
+
+	ntwkCfg := plan.networkConfig()
 	netclient.MustConfigureNetwork(ctx, &ntwkCfg)
 	return nil
 }
 
+// networkConfig returns the network configuration this plan instance should
+// run with
+func (plan *Plan) networkConfig() network.Config {
+	// partition rules come first, so dropped traffic can't be reshaped
+	rules := append([]network.LinkRule{}, plan.partition.rules...)
+	rules = append(rules, plan.linkRules...)
+
+	return network.Config{
+		// Control the "default" network. At the moment, this is the only network.
+		Network: "default",
+
+		// Enable this network. Setting this to false will disconnect this test
+		// instance from this network. You probably don't want to do that.
+		Enable:        true,
+		Default:       plan.networkDefaultShape(),
+		Rules:         rules,
+		CallbackState: "network-configured",
+	}
+}
+
 // ActorConstructor is a function that creates an actor
 type ActorConstructor func(context.Context, *Plan) (*sim.Actor, error)
 
@@ -156,6 +305,8 @@ func (plan *Plan) ShareInfo(ctx context.Context) error {
 			plan.Actor.Inst.Node().Host().Peerstore().AddAddrs(info.AddrInfo.ID, info.AddrInfo.Addrs, peerstore.PermanentAddrTTL)
 		case err := <-sub.Done():
 			return err
+		case <-ctx.Done():
+			return ctx.Err()
 		}
 	}
 
@@ -181,30 +332,36 @@ func (plan *Plan) Finished(ctx context.Context) <-chan error {
 	return plan.finishedC
 }
 
-// Close finalizes the plan & cleans up resources
+// Close finalizes the plan & cleans up resources, including the plan's actor
 func (plan *Plan) Close() {
+	if plan.Actor != nil {
+		if err := plan.Actor.Close(); err != nil {
+			plan.Runenv.RecordMessage("error closing actor: %s", err)
+		}
+	}
 	plan.Client.Close()
 }
 
-// DialOtherPeers dials a portion of peers
+// DialOtherPeers connects to this instance's neighbours in the topology set
+// by Cfg.Topology. each edge is dialed by the instance with the larger
+// sequence number, preventing TCP simultaneous connect (known to fail)
 func (plan *Plan) DialOtherPeers(ctx context.Context) ([]peer.AddrInfo, error) {
+	topo, err := plan.Topology()
+	if err != nil {
+		return nil, err
+	}
+
 	// Grab list of other peers that are available for this Run
 	var toDial []peer.AddrInfo
 	host := plan.Actor.Inst.Node().Host()
-	myID, _ := host.ID().MarshalBinary()
-
 	for _, ai := range plan.Others {
-		byteID, _ := ai.AddrInfo.ID.MarshalBinary()
-
-		// skip over dialing ourselves, and prevent TCP simultaneous
-		// connect (known to fail) by only dialing peers whose peer ID
-		// is smaller than ours.
-		if bytes.Compare(byteID, myID) < 0 {
+		seq := int64(ai.Seq)
+		if seq < plan.Seq && topo.Connected(plan.Seq, seq) {
 			toDial = append(toDial, *ai.AddrInfo)
 		}
 	}
 
-	plan.Runenv.RecordMessage("peers I am going to dial: %v", toDial)
+	plan.Runenv.RecordMessage("%s topology, peers I am going to dial: %v", topo.Kind, toDial)
 	// Dial to all the other peers
 	g, ctx := errgroup.WithContext(ctx)
 	for _, ai := range toDial {
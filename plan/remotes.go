@@ -0,0 +1,73 @@
+package plan
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/qri-io/qri/config"
+	"github.com/qri-io/test-plans/sim"
+	"github.com/testground/sdk-go/sync"
+)
+
+// RemoteInfo contains the details needed to connect to a qri remote. Remotes
+// broadcast their RemoteInfo over the RemoteInfoTopic, actors that push to or
+// pull from remotes subscribe to the topic to learn about each remote
+type RemoteInfo struct {
+	Peername string // qri username
+	PeerID   string // peerID associated with the remote
+}
+
+// RemoteInfoTopic is the topic remotes advertise themselves on
+var RemoteInfoTopic = sync.NewTopic("remote-info", &RemoteInfo{})
+
+// StateRemoteInfoSent is signalled by each remote once it has published its
+// RemoteInfo
+var StateRemoteInfoSent = sync.State("remote info sent")
+
+// PublishRemoteInfo advertises act as a remote. It accepts an actor instead of
+// using plan.Actor so it can be called from within an ActorConstructor
+func (plan *Plan) PublishRemoteInfo(ctx context.Context, act *sim.Actor) error {
+	pro, err := act.Inst.Repo().Profile()
+	if err != nil {
+		return err
+	}
+
+	plan.Runenv.RecordMessage("Sending my remote info")
+	if _, err := plan.Client.Publish(ctx, RemoteInfoTopic, &RemoteInfo{
+		Peername: pro.Peername,
+		PeerID:   act.AddrInfo().ID.Pretty(),
+	}); err != nil {
+		return fmt.Errorf("publishing remote info: %w", err)
+	}
+	plan.Client.MustSignalEntry(ctx, StateRemoteInfoSent)
+	return nil
+}
+
+// ReceiveRemoteInfo waits for numRemotes remotes to publish their info & adds
+// each of them to act's configuration
+func (plan *Plan) ReceiveRemoteInfo(ctx context.Context, act *sim.Actor, numRemotes int) error {
+	plan.Runenv.RecordMessage("waiting for remote info")
+	if err := <-plan.Client.MustBarrier(ctx, StateRemoteInfoSent, numRemotes).C; err != nil {
+		return err
+	}
+
+	rtCh := make(chan *RemoteInfo)
+	sub, err := plan.Client.Subscribe(ctx, RemoteInfoTopic, rtCh)
+	if err != nil {
+		return fmt.Errorf("remote info subscription failure: %w", err)
+	}
+
+	act.Inst.Config().Remotes = &config.Remotes{}
+	for i := 0; i < numRemotes; i++ {
+		select {
+		case r := <-rtCh:
+			act.Inst.Config().Remotes.SetArbitrary(r.Peername, r.PeerID)
+			plan.Runenv.RecordMessage("received remote info from %q", r.Peername)
+		case err := <-sub.Done():
+			return err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
@@ -0,0 +1,181 @@
+package plan
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/testground/sdk-go/sync"
+)
+
+// Role is a named kind of actor in a test plan
+type Role struct {
+	Name string
+	// Weight is the share of instances assigned this role, relative to the
+	// weights of all other roles
+	Weight int
+}
+
+// Roles is a deterministic assignment of a role to every instance in a run.
+// Because each instance computes the same assignment, Roles can be used to
+// size barriers that wait on every member of a role
+type Roles struct {
+	names    []string
+	assigned map[int64]string
+}
+
+// NewRoles creates a role assignment from a map of instance sequence numbers
+// to role names. names sets the order roles are listed in, any role assigned
+// in the map but missing from names is appended in alphabetical order
+func NewRoles(assigned map[int64]string, names ...string) *Roles {
+	r := &Roles{
+		names:    append([]string{}, names...),
+		assigned: assigned,
+	}
+
+	listed := map[string]bool{}
+	for _, name := range names {
+		listed[name] = true
+	}
+	var extra []string
+	for _, name := range assigned {
+		if !listed[name] {
+			listed[name] = true
+			extra = append(extra, name)
+		}
+	}
+	sort.Strings(extra)
+	r.names = append(r.names, extra...)
+	return r
+}
+
+// NewWeightedRoles assigns roles to total instances by weight. Sequence
+// numbers are split into consecutive blocks the size of the summed weights,
+// within each block the first Weight instances get the first role, the next
+// Weight instances the second role, and so on
+func NewWeightedRoles(total int, roles ...Role) (*Roles, error) {
+	if len(roles) == 0 {
+		return nil, fmt.Errorf("at least one role is required")
+	}
+	names := make([]string, len(roles))
+	blockSize := 0
+	for i, role := range roles {
+		if role.Weight < 1 {
+			return nil, fmt.Errorf("role %q must have a positive weight", role.Name)
+		}
+		names[i] = role.Name
+		blockSize += role.Weight
+	}
+
+	assigned := make(map[int64]string, total)
+	// seq numbers start at 1
+	for seq := int64(1); seq <= int64(total); seq++ {
+		pos := int((seq - 1) % int64(blockSize))
+		for _, role := range roles {
+			if pos < role.Weight {
+				assigned[seq] = role.Name
+				break
+			}
+			pos -= role.Weight
+		}
+	}
+
+	r := NewRoles(assigned, names...)
+	for _, name := range names {
+		if r.Count(name) == 0 {
+			return nil, fmt.Errorf("role %q has no instances, %d instances are too few for the given weights", name, total)
+		}
+	}
+	return r, nil
+}
+
+// Names lists all roles
+func (r *Roles) Names() []string {
+	return r.names
+}
+
+// RoleOf returns the role assigned to the instance with sequence number seq
+func (r *Roles) RoleOf(seq int64) string {
+	return r.assigned[seq]
+}
+
+// Count returns the number of instances assigned the named role
+func (r *Roles) Count(name string) int {
+	count := 0
+	for _, role := range r.assigned {
+		if role == name {
+			count++
+		}
+	}
+	return count
+}
+
+// Members lists the sequence numbers of all instances with the named role,
+// in ascending order
+func (r *Roles) Members(name string) []int64 {
+	var members []int64
+	for seq, role := range r.assigned {
+		if role == name {
+			members = append(members, seq)
+		}
+	}
+	sort.Slice(members, func(i, j int) bool { return members[i] < members[j] })
+	return members
+}
+
+// AssignRoles assigns every instance in the plan a role by weight
+func (plan *Plan) AssignRoles(roles ...Role) error {
+	r, err := NewWeightedRoles(plan.Runenv.TestInstanceCount, roles...)
+	if err != nil {
+		return err
+	}
+	plan.Roles = r
+	plan.Runenv.RecordMessage("assigned role %q", plan.Role())
+	return nil
+}
+
+// instanceGroup pairs an instance sequence number with its testground group
+type instanceGroup struct {
+	Seq   int64
+	Group string
+}
+
+var instanceGroupTopic = sync.NewTopic("instance-group", &instanceGroup{})
+
+// AssignGroupRoles uses testground groups as roles. Every instance publishes
+// its group, then waits to learn the group of every other instance
+func (plan *Plan) AssignGroupRoles(ctx context.Context) error {
+	ch := make(chan *instanceGroup)
+	_, sub, err := plan.Client.PublishSubscribe(ctx, instanceGroupTopic, &instanceGroup{
+		Seq:   plan.Seq,
+		Group: plan.Runenv.TestGroupID,
+	}, ch)
+	if err != nil {
+		return fmt.Errorf("sharing instance group: %w", err)
+	}
+
+	assigned := make(map[int64]string, plan.Runenv.TestInstanceCount)
+	for len(assigned) < plan.Runenv.TestInstanceCount {
+		select {
+		case ig := <-ch:
+			assigned[ig.Seq] = ig.Group
+		case err := <-sub.Done():
+			return err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	plan.Roles = NewRoles(assigned)
+	plan.Runenv.RecordMessage("assigned role %q", plan.Role())
+	return nil
+}
+
+// Role returns the role assigned to this plan instance, or the empty string if
+// roles haven't been assigned
+func (plan *Plan) Role() string {
+	if plan.Roles == nil {
+		return ""
+	}
+	return plan.Roles.RoleOf(plan.Seq)
+}
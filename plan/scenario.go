@@ -0,0 +1,471 @@
+package plan
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/qri-io/qri/dsref"
+	"github.com/qri-io/qri/lib"
+	"github.com/qri-io/test-plans/sim"
+	"github.com/testground/sdk-go/sync"
+)
+
+// Scenario is a declarative description of a test case, usually loaded from a
+// TOML file. RunScenario interprets a scenario's steps, so new network
+// experiments don't need a hand-written RunPlan function
+type Scenario struct {
+	Name     string         `toml:"name"`
+	Roles    []ScenarioRole `toml:"roles"`
+	Datasets []DatasetSpec  `toml:"datasets"`
+	Steps    []Step         `toml:"steps"`
+}
+
+// ScenarioRole describes a kind of actor in a scenario
+type ScenarioRole struct {
+	Name string `toml:"name"`
+	// Count is the number of instances assigned this role. A count of zero
+	// assigns every instance not claimed by another role
+	Count int `toml:"count"`
+	// Remote enables the qri remote for actors with this role
+	Remote bool `toml:"remote"`
+}
+
+// DatasetSpec describes a dataset actors generate when they're constructed
+type DatasetSpec struct {
+	Name string `toml:"name"`
+	Rows int    `toml:"rows"`
+	// Bytes is a target body size for the first version. When set, the
+	// number of rows is estimated from it & Rows is ignored
+	Bytes int64 `toml:"bytes"`
+	// Versions is the number of versions to save, defaults to 1
+	Versions int `toml:"versions"`
+	// Mutation is how each version differs from the last, one of "append",
+	// "change" or "schema". defaults to "append"
+	Mutation string `toml:"mutation"`
+	// Shape selects the body generator, see sim.DatasetShapes. defaults to
+	// "default"
+	Shape string `toml:"shape"`
+	// Roles lists the roles that generate this dataset
+	Roles []string `toml:"roles"`
+}
+
+// StepAction enumerates the kinds of step a scenario can take
+type StepAction string
+
+const (
+	// StepConstruct creates an actor for every instance
+	StepConstruct = StepAction("construct")
+	// StepShareInfo shares actor & remote info between all instances
+	StepShareInfo = StepAction("share_info")
+	// StepDial connects actors to other peers
+	StepDial = StepAction("dial")
+	// StepPush pushes a dataset to all known remotes
+	StepPush = StepAction("push")
+	// StepPull pulls a dataset from all known remotes
+	StepPull = StepAction("pull")
+	// StepWait blocks until a sync state reaches a target count
+	StepWait = StepAction("wait")
+	// StepAssert checks a condition on the actor's state
+	StepAssert = StepAction("assert")
+)
+
+// collective steps synchronize every instance, and must be taken by all roles
+var collective = map[StepAction]bool{
+	StepConstruct: true,
+	StepShareInfo: true,
+}
+
+// Step is a single action in a scenario
+type Step struct {
+	Action StepAction `toml:"action"`
+	// Roles limits the step to actors with the listed roles. Empty means all
+	Roles []string `toml:"roles"`
+	// Dataset names the dataset push, pull and assert steps operate on. assert
+	// steps also accept a full "username/name" reference
+	Dataset string `toml:"dataset"`
+	// Signal is a sync state to signal entry into once the step is done,
+	// regardless of whether it succeeded. Only instances with one of the
+	// step's Roles signal
+	Signal string `toml:"signal"`
+	// State is the sync state a wait step blocks on. The wait ends once the
+	// state has Count entries, or one entry for each instance with Role if
+	// Count is zero, or one entry for every instance if both are empty
+	State string `toml:"state"`
+	Role  string `toml:"role"`
+	Count int    `toml:"count"`
+	// Duration is an optional pause in milliseconds for wait steps
+	Duration int `toml:"duration_ms"`
+	// Assert names the check an assert step makes, one of "foreign_logs"
+	// or "dataset"
+	Assert string `toml:"assert"`
+	// Expect is the expected value for an assertion. If ExpectRole is set the
+	// expected value is the number of instances with that role instead
+	Expect     int    `toml:"expect"`
+	ExpectRole string `toml:"expect_role"`
+	// AllowFailure records step errors as messages instead of failing the run
+	AllowFailure bool `toml:"allow_failure"`
+}
+
+// LoadScenario reads a scenario from a TOML file
+func LoadScenario(path string) (*Scenario, error) {
+	sc := &Scenario{}
+	if _, err := toml.DecodeFile(path, sc); err != nil {
+		return nil, fmt.Errorf("reading scenario %q: %w", path, err)
+	}
+	if err := sc.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid scenario %q: %w", path, err)
+	}
+	return sc, nil
+}
+
+// Validate checks a scenario is well formed
+func (sc *Scenario) Validate() error {
+	if len(sc.Roles) == 0 {
+		return fmt.Errorf("at least one role is required")
+	}
+	roles := map[string]bool{}
+	remainders := 0
+	for _, r := range sc.Roles {
+		if r.Name == "" {
+			return fmt.Errorf("roles must have a name")
+		}
+		if roles[r.Name] {
+			return fmt.Errorf("duplicate role %q", r.Name)
+		}
+		roles[r.Name] = true
+		if r.Count < 0 {
+			return fmt.Errorf("role %q: count cannot be negative", r.Name)
+		}
+		if r.Count == 0 {
+			remainders++
+		}
+	}
+	if remainders > 1 {
+		return fmt.Errorf("only one role can omit a count")
+	}
+
+	checkRoles := func(names []string, where string) error {
+		for _, name := range names {
+			if !roles[name] {
+				return fmt.Errorf("%s: unknown role %q", where, name)
+			}
+		}
+		return nil
+	}
+
+	datasets := map[string]bool{}
+	for _, ds := range sc.Datasets {
+		if ds.Name == "" {
+			return fmt.Errorf("datasets must have a name")
+		}
+		datasets[ds.Name] = true
+		if _, err := sim.ParseMutation(ds.Mutation); err != nil {
+			return fmt.Errorf("dataset %q: %w", ds.Name, err)
+		}
+		if _, err := sim.NewDatasetGenerator(sim.DatasetShape(ds.Shape), 0); err != nil {
+			return fmt.Errorf("dataset %q: %w", ds.Name, err)
+		}
+		if ds.Rows < 0 || ds.Bytes < 0 {
+			return fmt.Errorf("dataset %q: rows & bytes cannot be negative", ds.Name)
+		}
+		if err := checkRoles(ds.Roles, fmt.Sprintf("dataset %q", ds.Name)); err != nil {
+			return err
+		}
+	}
+
+	for i, step := range sc.Steps {
+		where := fmt.Sprintf("step %d (%s)", i, step.Action)
+		if collective[step.Action] && len(step.Roles) > 0 {
+			return fmt.Errorf("%s: is taken by all instances and cannot specify roles", where)
+		}
+		switch step.Action {
+		case StepConstruct, StepShareInfo, StepDial:
+		case StepPush, StepPull:
+			if !datasets[step.Dataset] {
+				return fmt.Errorf("%s: unknown dataset %q", where, step.Dataset)
+			}
+		case StepWait:
+			if step.State == "" && step.Duration == 0 {
+				return fmt.Errorf("%s: wait steps need a state or a duration", where)
+			}
+			if step.Role != "" && !roles[step.Role] {
+				return fmt.Errorf("%s: unknown role %q", where, step.Role)
+			}
+		case StepAssert:
+			if step.Assert != "foreign_logs" && step.Assert != "dataset" {
+				return fmt.Errorf("%s: unknown assertion %q", where, step.Assert)
+			}
+			if step.ExpectRole != "" && !roles[step.ExpectRole] {
+				return fmt.Errorf("%s: unknown role %q", where, step.ExpectRole)
+			}
+		default:
+			return fmt.Errorf("%s: unknown action", where)
+		}
+		if err := checkRoles(step.Roles, where); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// roleCounts returns the number of instances assigned to each role, in role
+// order, for a run of total instances
+func (sc *Scenario) roleCounts(total int) ([]int, error) {
+	counts := make([]int, len(sc.Roles))
+	claimed := 0
+	remainder := -1
+	for i, r := range sc.Roles {
+		if r.Count == 0 {
+			remainder = i
+			continue
+		}
+		counts[i] = r.Count
+		claimed += r.Count
+	}
+	if claimed > total {
+		return nil, fmt.Errorf("scenario roles need %d instances, but there are only %d", claimed, total)
+	}
+	if remainder >= 0 {
+		counts[remainder] = total - claimed
+	} else if claimed != total {
+		return nil, fmt.Errorf("scenario roles need exactly %d instances, but there are %d", claimed, total)
+	}
+	return counts, nil
+}
+
+// RoleAssignment assigns scenario roles to total instances. roles are handed
+// out to contiguous blocks of sequence numbers, in role order
+func (sc *Scenario) RoleAssignment(total int) (*Roles, error) {
+	counts, err := sc.roleCounts(total)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, len(sc.Roles))
+	assigned := make(map[int64]string, total)
+	// seq numbers start at 1
+	seq := int64(1)
+	for i, r := range sc.Roles {
+		names[i] = r.Name
+		for j := 0; j < counts[i]; j++ {
+			assigned[seq] = r.Name
+			seq++
+		}
+	}
+	return NewRoles(assigned, names...), nil
+}
+
+// role fetches a role definition by name
+func (sc *Scenario) role(name string) ScenarioRole {
+	for _, r := range sc.Roles {
+		if r.Name == name {
+			return r
+		}
+	}
+	return ScenarioRole{}
+}
+
+// RunScenario executes each step of a scenario in order
+func (plan *Plan) RunScenario(ctx context.Context, sc *Scenario) error {
+	roles, err := sc.RoleAssignment(plan.Runenv.TestInstanceCount)
+	if err != nil {
+		return err
+	}
+	plan.Roles = roles
+	role := sc.role(plan.Role())
+	plan.Runenv.RecordMessage("running scenario %q as role %q", sc.Name, role.Name)
+
+	if err := plan.SetupNetwork(ctx); err != nil {
+		return err
+	}
+
+	for i, step := range sc.Steps {
+		err := plan.runStep(ctx, sc, role, step)
+		// only instances that took the step signal, so waits on the state
+		// count exactly the instances that finished it
+		if step.Signal != "" && stepIncludesRole(step, role.Name) {
+			plan.Client.MustSignalEntry(ctx, sync.State(step.Signal))
+		}
+		if err != nil {
+			err = fmt.Errorf("step %d (%s): %w", i, step.Action, err)
+			if !step.AllowFailure {
+				return err
+			}
+			plan.Runenv.RecordMessage("allowed failure: %s", err)
+		}
+	}
+
+	plan.ActorFinished(ctx)
+	return plan.Outcome(ctx)
+}
+
+func (plan *Plan) runStep(ctx context.Context, sc *Scenario, role ScenarioRole, step Step) error {
+	if !stepIncludesRole(step, role.Name) {
+		return nil
+	}
+
+	switch step.Action {
+	case StepConstruct:
+		return plan.ConstructActor(ctx, scenarioActorConstructor(sc, role))
+	case StepShareInfo:
+		if err := plan.ShareInfo(ctx); err != nil {
+			return err
+		}
+		return plan.shareScenarioRemotes(ctx, sc, role)
+	case StepDial:
+		_, err := plan.DialOtherPeers(ctx)
+		return err
+	case StepPush:
+		return plan.PushToRemotes(ctx, step.Dataset)
+	case StepPull:
+		return plan.PullFromRemotes(ctx, step.Dataset)
+	case StepWait:
+		if step.Duration > 0 {
+			select {
+			case <-time.After(time.Duration(step.Duration) * time.Millisecond):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		if step.State == "" {
+			return nil
+		}
+		target := step.Count
+		if target == 0 && step.Role != "" {
+			target = plan.Roles.Count(step.Role)
+		}
+		if target == 0 {
+			target = plan.Runenv.TestInstanceCount
+		}
+		plan.Runenv.RecordMessage("waiting for %d entries on %q", target, step.State)
+		return <-plan.Client.MustBarrier(ctx, sync.State(step.State), target).C
+	case StepAssert:
+		err := plan.scenarioAssert(ctx, sc, step)
+		if step.AllowFailure {
+			return err
+		}
+		// failed assertions fail the run once every instance has finished
+		plan.Assert(step.Assert, err)
+		return nil
+	}
+	return fmt.Errorf("unknown action %q", step.Action)
+}
+
+func stepIncludesRole(step Step, role string) bool {
+	if len(step.Roles) == 0 {
+		return true
+	}
+	for _, r := range step.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// scenarioActorConstructor creates an actor for role, generating each dataset
+// the role is responsible for
+func scenarioActorConstructor(sc *Scenario, role ScenarioRole) ActorConstructor {
+	return func(ctx context.Context, plan *Plan) (*sim.Actor, error) {
+		var opts []lib.Option
+		if role.Remote {
+			opts = append(opts, lib.OptEnableRemote())
+		}
+		act, err := sim.NewActor(ctx, plan.Runenv, plan.Client, plan.Seq, opts...)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, ds := range sc.Datasets {
+			if len(ds.Roles) > 0 && !stepIncludesRole(Step{Roles: ds.Roles}, role.Name) {
+				continue
+			}
+			versions := ds.Versions
+			if versions < 1 {
+				versions = 1
+			}
+			// mutations & shapes are checked by Validate
+			mutation, _ := sim.ParseMutation(ds.Mutation)
+			gen, _ := act.NewDatasetGenerator(sim.DatasetShape(ds.Shape))
+			rows := ds.Rows
+			if ds.Bytes > 0 {
+				if rows, err = sim.RowsForBytes(gen, ds.Bytes); err != nil {
+					return nil, err
+				}
+			}
+			if err := act.GenerateDatasetHistory(ds.Name, gen, rows, versions, mutation); err != nil {
+				return nil, err
+			}
+			if err := plan.RecordDatasetStats(ctx, act, ds.Name); err != nil {
+				return nil, err
+			}
+		}
+
+		if err := act.Inst.Connect(ctx); err != nil {
+			return nil, err
+		}
+
+		plan.Runenv.RecordMessage("I'm a %s named %s", role.Name, act.Peername())
+		plan.Runenv.RecordMessage("My qri ID is %s", act.ID())
+		plan.Runenv.RecordMessage("My peer ID is %s", act.AddrInfo().ID)
+		return act, nil
+	}
+}
+
+// shareScenarioRemotes has actors with remote roles advertise themselves, and
+// everyone else collect the remotes they can push to and pull from
+func (plan *Plan) shareScenarioRemotes(ctx context.Context, sc *Scenario, role ScenarioRole) error {
+	if role.Remote {
+		return plan.PublishRemoteInfo(ctx, plan.Actor)
+	}
+
+	numRemotes := 0
+	for _, r := range sc.Roles {
+		if r.Remote {
+			numRemotes += plan.Roles.Count(r.Name)
+		}
+	}
+	if numRemotes == 0 {
+		return nil
+	}
+	if err := plan.ReceiveRemoteInfo(ctx, plan.Actor, numRemotes); err != nil {
+		return err
+	}
+	plan.Runenv.RecordMessage("My remotes are %v", plan.Actor.Inst.Config().Remotes)
+	return nil
+}
+
+func (plan *Plan) scenarioAssert(ctx context.Context, sc *Scenario, step Step) error {
+	expect := step.Expect
+	if step.ExpectRole != "" {
+		expect = plan.Roles.Count(step.ExpectRole)
+	}
+
+	switch step.Assert {
+	case "foreign_logs":
+		count, err := plan.RecordForeignLogs(ctx)
+		if err != nil {
+			return err
+		}
+		if count != expect {
+			return fmt.Errorf("expected %d foreign logs, found %d", expect, count)
+		}
+	case "dataset":
+		// dataset names without a username refer to the actor's own datasets
+		ref := &dsref.Ref{Username: "me", Name: step.Dataset}
+		if strings.Contains(step.Dataset, "/") {
+			parsed, err := dsref.Parse(step.Dataset)
+			if err != nil {
+				return err
+			}
+			ref = &parsed
+		}
+		if _, err := plan.Actor.Inst.ResolveReference(ctx, ref, "local"); err != nil {
+			return fmt.Errorf("resolving %q: %w", ref.Human(), err)
+		}
+	}
+	return nil
+}
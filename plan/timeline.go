@@ -0,0 +1,216 @@
+package plan
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	gosync "sync"
+	"time"
+
+	"github.com/testground/sdk-go/runtime"
+	"github.com/testground/sdk-go/sync"
+)
+
+// SyncEventsAsset is the name of the output file each instance writes sync
+// events to, one JSON object per line
+const SyncEventsAsset = "sync_events.jsonl"
+
+// SyncEventKind names a kind of sync event
+type SyncEventKind string
+
+const (
+	// SyncEventSignal is recorded when the instance signals entry into a state
+	SyncEventSignal = SyncEventKind("signal")
+	// SyncEventWait is recorded when the instance starts waiting on a barrier
+	SyncEventWait = SyncEventKind("wait")
+	// SyncEventRelease is recorded when a barrier fires, with an error if it
+	// failed
+	SyncEventRelease = SyncEventKind("release")
+)
+
+// SyncEvent records a single signal entry, barrier wait or barrier release
+type SyncEvent struct {
+	Kind  SyncEventKind `json:"kind"`
+	State string        `json:"state"`
+	// Target is the entry count a barrier waits for
+	Target int `json:"target,omitempty"`
+	// Count is the entry count of the state after a signal
+	Count int64 `json:"count,omitempty"`
+	// Barrier identifies the barrier a wait or release belongs to, unique
+	// within an instance
+	Barrier int64  `json:"barrier,omitempty"`
+	Error   string `json:"error,omitempty"`
+	// Seq is the sequence number of the instance. It's zero for events
+	// recorded before the instance is assigned one
+	Seq  int64     `json:"seq"`
+	Time time.Time `json:"time"`
+}
+
+// syncRecorder is a sync.Client that records every signal entry & barrier it
+// handles to an output file, so a run's progress through its sync states can
+// be rebuilt afterward
+type syncRecorder struct {
+	sync.Client
+	runenv *runtime.RunEnv
+
+	lk       gosync.Mutex
+	f        *os.File
+	enc      *json.Encoder
+	seq      int64
+	barriers int64
+	closed   bool
+}
+
+// assert at compile time that syncRecorder is a sync.Client
+var _ sync.Client = (*syncRecorder)(nil)
+
+func newSyncRecorder(runenv *runtime.RunEnv, client sync.Client) (*syncRecorder, error) {
+	f, err := runenv.CreateRawAsset(SyncEventsAsset)
+	if err != nil {
+		return nil, err
+	}
+	return &syncRecorder{
+		Client: client,
+		runenv: runenv,
+		f:      f,
+		enc:    json.NewEncoder(f),
+	}, nil
+}
+
+// setSeq sets the sequence number recorded with every later event
+func (r *syncRecorder) setSeq(seq int64) {
+	r.lk.Lock()
+	defer r.lk.Unlock()
+	r.seq = seq
+}
+
+// record writes an event. failures are logged instead of returned so
+// recording never changes the outcome of a sync call
+func (r *syncRecorder) record(evt SyncEvent) {
+	r.lk.Lock()
+	defer r.lk.Unlock()
+	if r.closed {
+		return
+	}
+	evt.Seq = r.seq
+	evt.Time = time.Now()
+	if err := r.enc.Encode(evt); err != nil {
+		r.runenv.RecordMessage("error writing sync event: %s", err)
+	}
+}
+
+func (r *syncRecorder) nextBarrier() int64 {
+	r.lk.Lock()
+	defer r.lk.Unlock()
+	r.barriers++
+	return r.barriers
+}
+
+// Close closes the events file & the wrapped client
+func (r *syncRecorder) Close() error {
+	r.lk.Lock()
+	r.closed = true
+	fErr := r.f.Close()
+	r.lk.Unlock()
+	if err := r.Client.Close(); err != nil {
+		return err
+	}
+	return fErr
+}
+
+// Barrier records waiting on a barrier, & its release once it fires
+func (r *syncRecorder) Barrier(ctx context.Context, state sync.State, target int) (*sync.Barrier, error) {
+	id := r.nextBarrier()
+	r.record(SyncEvent{Kind: SyncEventWait, State: string(state), Target: target, Barrier: id})
+	b, err := r.Client.Barrier(ctx, state, target)
+	if err != nil {
+		r.record(SyncEvent{Kind: SyncEventRelease, State: string(state), Target: target, Barrier: id, Error: err.Error()})
+		return nil, err
+	}
+
+	ch := make(chan error, 1)
+	go func() {
+		err := <-b.C
+		evt := SyncEvent{Kind: SyncEventRelease, State: string(state), Target: target, Barrier: id}
+		if err != nil {
+			evt.Error = err.Error()
+		}
+		r.record(evt)
+		ch <- err
+		close(ch)
+	}()
+	return &sync.Barrier{C: ch}, nil
+}
+
+// SignalEntry records signalling entry into state
+func (r *syncRecorder) SignalEntry(ctx context.Context, state sync.State) (int64, error) {
+	count, err := r.Client.SignalEntry(ctx, state)
+	evt := SyncEvent{Kind: SyncEventSignal, State: string(state), Count: count}
+	if err != nil {
+		evt.Error = err.Error()
+	}
+	r.record(evt)
+	return count, err
+}
+
+// PublishAndWait publishes payload, then waits for state to reach target
+func (r *syncRecorder) PublishAndWait(ctx context.Context, topic *sync.Topic, payload interface{}, state sync.State, target int) (int64, error) {
+	seq, err := r.Publish(ctx, topic, payload)
+	if err != nil {
+		return -1, err
+	}
+	b, err := r.Barrier(ctx, state, target)
+	if err != nil {
+		return seq, err
+	}
+	return seq, <-b.C
+}
+
+// SignalAndWait signals entry into state & waits for it to reach target
+func (r *syncRecorder) SignalAndWait(ctx context.Context, state sync.State, target int) (int64, error) {
+	seq, err := r.SignalEntry(ctx, state)
+	if err != nil {
+		return -1, err
+	}
+	b, err := r.Barrier(ctx, state, target)
+	if err != nil {
+		return seq, err
+	}
+	return seq, <-b.C
+}
+
+// MustBarrier calls Barrier, panicking on error
+func (r *syncRecorder) MustBarrier(ctx context.Context, state sync.State, target int) *sync.Barrier {
+	b, err := r.Barrier(ctx, state, target)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+// MustSignalEntry calls SignalEntry, panicking on error
+func (r *syncRecorder) MustSignalEntry(ctx context.Context, state sync.State) int64 {
+	seq, err := r.SignalEntry(ctx, state)
+	if err != nil {
+		panic(err)
+	}
+	return seq
+}
+
+// MustPublishAndWait calls PublishAndWait, panicking on error
+func (r *syncRecorder) MustPublishAndWait(ctx context.Context, topic *sync.Topic, payload interface{}, state sync.State, target int) int64 {
+	seq, err := r.PublishAndWait(ctx, topic, payload, state, target)
+	if err != nil {
+		panic(err)
+	}
+	return seq
+}
+
+// MustSignalAndWait calls SignalAndWait, panicking on error
+func (r *syncRecorder) MustSignalAndWait(ctx context.Context, state sync.State, target int) int64 {
+	seq, err := r.SignalAndWait(ctx, state, target)
+	if err != nil {
+		panic(err)
+	}
+	return seq
+}
@@ -0,0 +1,268 @@
+package plan
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"sort"
+
+	"github.com/testground/sdk-go/runtime"
+)
+
+// TopologyKind names a way of connecting instances before a test starts
+type TopologyKind string
+
+const (
+	// TopologyFullMesh connects every instance to every other instance
+	TopologyFullMesh = TopologyKind("full_mesh")
+	// TopologyRing connects each instance to the instances before & after it
+	TopologyRing = TopologyKind("ring")
+	// TopologyStar connects every instance to the hub instances, & hubs to
+	// each other
+	TopologyStar = TopologyKind("star")
+	// TopologyRandomRegular connects each instance to Degree random instances
+	TopologyRandomRegular = TopologyKind("random_regular")
+	// TopologySmallWorld is a Watts-Strogatz graph: a ring lattice where each
+	// instance connects to its Degree nearest instances, with each edge
+	// rewired to a random instance with probability Rewire
+	TopologySmallWorld = TopologyKind("small_world")
+	// TopologyNone dials no one, leaving connections to peer discovery
+	TopologyNone = TopologyKind("none")
+)
+
+// TopologyKinds lists all topologies
+var TopologyKinds = []TopologyKind{TopologyFullMesh, TopologyRing, TopologyStar, TopologyRandomRegular, TopologySmallWorld, TopologyNone}
+
+// defaultTopologyDegree is used by topologies with a degree when the
+// topology_degree param isn't set
+const defaultTopologyDegree = 4
+
+// maxRegularAttempts bounds the number of random pairings tried when building
+// a random regular graph
+const maxRegularAttempts = 100
+
+// TopologyConfig selects the topology DialOtherPeers builds
+type TopologyConfig struct {
+	Kind TopologyKind
+	// Degree is the number of neighbours each instance has in random regular
+	// & small world topologies
+	Degree int
+	// Rewire is the probability from 0 to 1 a small world edge is rewired
+	Rewire float64
+	// HubRole names the role whose instances are hubs of a star topology. if
+	// empty or unassigned, the instance with sequence number 1 is the hub
+	HubRole string
+	// Seed seeds random topologies. every instance must use the same seed to
+	// agree on the graph
+	Seed int64
+}
+
+// TopologyConfigFromRuntimeEnv parses topology configuration from the
+// runtime environment, defaulting to a full mesh
+func TopologyConfigFromRuntimeEnv(runenv *runtime.RunEnv) TopologyConfig {
+	cfg := TopologyConfig{
+		Kind:   TopologyFullMesh,
+		Degree: defaultTopologyDegree,
+	}
+	if runenv.IsParamSet("topology") {
+		cfg.Kind = TopologyKind(runenv.StringParam("topology"))
+	}
+	if runenv.IsParamSet("topology_degree") {
+		cfg.Degree = runenv.IntParam("topology_degree")
+	}
+	if runenv.IsParamSet("topology_rewire") {
+		cfg.Rewire = runenv.FloatParam("topology_rewire")
+	}
+	if runenv.IsParamSet("topology_hub_role") {
+		cfg.HubRole = runenv.StringParam("topology_hub_role")
+	}
+	if runenv.IsParamSet("topology_seed") {
+		cfg.Seed = int64(runenv.IntParam("topology_seed"))
+	} else {
+		// the run ID is shared by every instance, giving each run a different
+		// graph all instances agree on
+		h := fnv.New64a()
+		h.Write([]byte(runenv.TestRun))
+		cfg.Seed = int64(h.Sum64())
+	}
+	return cfg
+}
+
+// Topology is an undirected graph of instance sequence numbers
+type Topology struct {
+	Kind  TopologyKind
+	edges map[int64]map[int64]bool
+}
+
+// NewTopology builds the topology cfg describes for instances numbered 1 to
+// total. hubs are the hubs of a star topology, ignored by other kinds
+func NewTopology(cfg TopologyConfig, total int, hubs []int64) (*Topology, error) {
+	t := &Topology{Kind: cfg.Kind, edges: map[int64]map[int64]bool{}}
+	n := int64(total)
+	rnd := rand.New(rand.NewSource(cfg.Seed))
+
+	switch cfg.Kind {
+	case "", TopologyFullMesh:
+		t.Kind = TopologyFullMesh
+		for a := int64(1); a <= n; a++ {
+			for b := a + 1; b <= n; b++ {
+				t.connect(a, b)
+			}
+		}
+	case TopologyRing:
+		for a := int64(1); a <= n; a++ {
+			t.connect(a, a%n+1)
+		}
+	case TopologyStar:
+		if len(hubs) == 0 {
+			hubs = []int64{1}
+		}
+		for _, hub := range hubs {
+			for a := int64(1); a <= n; a++ {
+				t.connect(hub, a)
+			}
+		}
+	case TopologyRandomRegular:
+		if err := t.randomRegular(rnd, n, cfg.Degree); err != nil {
+			return nil, err
+		}
+	case TopologySmallWorld:
+		if cfg.Degree < 2 || int64(cfg.Degree) >= n {
+			return nil, fmt.Errorf("small world topology needs a degree between 2 & %d, got %d", n-1, cfg.Degree)
+		}
+		t.smallWorld(rnd, n, cfg.Degree, cfg.Rewire)
+	case TopologyNone:
+	default:
+		return nil, fmt.Errorf("unknown topology %q, must be one of %v", cfg.Kind, TopologyKinds)
+	}
+	return t, nil
+}
+
+// connect adds an edge between a & b. self-loops are ignored
+func (t *Topology) connect(a, b int64) {
+	if a == b {
+		return
+	}
+	if t.edges[a] == nil {
+		t.edges[a] = map[int64]bool{}
+	}
+	if t.edges[b] == nil {
+		t.edges[b] = map[int64]bool{}
+	}
+	t.edges[a][b] = true
+	t.edges[b][a] = true
+}
+
+func (t *Topology) disconnect(a, b int64) {
+	delete(t.edges[a], b)
+	delete(t.edges[b], a)
+}
+
+// Connected reports whether a & b share an edge
+func (t *Topology) Connected(a, b int64) bool {
+	return t.edges[a][b]
+}
+
+// Neighbors lists the instances seq shares an edge with, in order
+func (t *Topology) Neighbors(seq int64) []int64 {
+	ns := make([]int64, 0, len(t.edges[seq]))
+	for n := range t.edges[seq] {
+		ns = append(ns, n)
+	}
+	sort.Slice(ns, func(i, j int) bool { return ns[i] < ns[j] })
+	return ns
+}
+
+// randomRegular connects each instance to degree others. It pairs random
+// stubs, skipping pairs that would create self-loops or duplicate edges, &
+// starts over if it gets stuck (the Steger-Wormald algorithm)
+func (t *Topology) randomRegular(rnd *rand.Rand, n int64, degree int) error {
+	if degree < 1 || int64(degree) >= n || (n*int64(degree))%2 != 0 {
+		return fmt.Errorf("can't build a random %d-regular graph of %d instances. degree must be less than the number of instances, & their product even", degree, n)
+	}
+
+	for attempt := 0; attempt < maxRegularAttempts; attempt++ {
+		t.edges = map[int64]map[int64]bool{}
+		stubs := make([]int64, 0, n*int64(degree))
+		for a := int64(1); a <= n; a++ {
+			for i := 0; i < degree; i++ {
+				stubs = append(stubs, a)
+			}
+		}
+
+		for len(stubs) > 0 {
+			if !t.pairStubs(rnd, &stubs) {
+				break
+			}
+		}
+		if len(stubs) == 0 {
+			return nil
+		}
+	}
+	return fmt.Errorf("couldn't build a random %d-regular graph of %d instances in %d attempts", degree, n, maxRegularAttempts)
+}
+
+// pairStubs connects two random stubs that can share an edge, removing them
+// from stubs. it returns false if it can't find a pair
+func (t *Topology) pairStubs(rnd *rand.Rand, stubs *[]int64) bool {
+	s := *stubs
+	for try := 0; try < len(s)*len(s); try++ {
+		i, j := rnd.Intn(len(s)), rnd.Intn(len(s))
+		a, b := s[i], s[j]
+		if i == j || a == b || t.Connected(a, b) {
+			continue
+		}
+		t.connect(a, b)
+		// remove the larger index first so the smaller stays valid
+		if i < j {
+			i, j = j, i
+		}
+		s[i] = s[len(s)-1]
+		s = s[:len(s)-1]
+		s[j] = s[len(s)-1]
+		s = s[:len(s)-1]
+		*stubs = s
+		return true
+	}
+	return false
+}
+
+// smallWorld builds a ring lattice where each instance connects to degree/2
+// instances on either side, then rewires each edge with probability rewire
+func (t *Topology) smallWorld(rnd *rand.Rand, n int64, degree int, rewire float64) {
+	half := int64(degree / 2)
+	for a := int64(1); a <= n; a++ {
+		for j := int64(1); j <= half; j++ {
+			t.connect(a, (a+j-1)%n+1)
+		}
+	}
+
+	for a := int64(1); a <= n; a++ {
+		for j := int64(1); j <= half; j++ {
+			b := (a+j-1)%n + 1
+			if !t.Connected(a, b) || rnd.Float64() >= rewire {
+				continue
+			}
+			// instances connected to everyone can't be rewired
+			if int64(len(t.edges[a])) >= n-1 {
+				continue
+			}
+			c := a
+			for c == a || t.Connected(a, c) {
+				c = rnd.Int63n(n) + 1
+			}
+			t.disconnect(a, b)
+			t.connect(a, c)
+		}
+	}
+}
+
+// Topology builds the topology configured for this plan. hubs of a star
+// topology are the members of Cfg.Topology.HubRole, if roles are assigned
+func (plan *Plan) Topology() (*Topology, error) {
+	var hubs []int64
+	if plan.Roles != nil && plan.Cfg.Topology.HubRole != "" {
+		hubs = plan.Roles.Members(plan.Cfg.Topology.HubRole)
+	}
+	return NewTopology(plan.Cfg.Topology, plan.Runenv.TestInstanceCount, hubs)
+}
@@ -0,0 +1,187 @@
+package plan
+
+import (
+	"reflect"
+	"testing"
+)
+
+// checkSymmetric errors if an edge only goes one way or loops back to itself
+func checkSymmetric(t *testing.T, label string, topo *Topology, n int64) {
+	t.Helper()
+	for a := int64(1); a <= n; a++ {
+		for _, b := range topo.Neighbors(a) {
+			if a == b {
+				t.Errorf("%s: instance %d is its own neighbour", label, a)
+			}
+			if b < 1 || b > n {
+				t.Errorf("%s: instance %d has neighbour %d outside 1-%d", label, a, b, n)
+			}
+			if !topo.Connected(b, a) {
+				t.Errorf("%s: edge %d-%d isn't symmetric", label, a, b)
+			}
+		}
+	}
+}
+
+// edgeCount is the number of undirected edges in topo
+func edgeCount(topo *Topology, n int64) int {
+	count := 0
+	for a := int64(1); a <= n; a++ {
+		count += len(topo.Neighbors(a))
+	}
+	return count / 2
+}
+
+func TestTopologyDegrees(t *testing.T) {
+	cases := []struct {
+		cfg  TopologyConfig
+		n    int
+		hubs []int64
+		// degree returns the expected number of neighbours of seq
+		degree func(seq int64) int
+	}{
+		{TopologyConfig{Kind: TopologyFullMesh}, 1, nil, func(int64) int { return 0 }},
+		{TopologyConfig{Kind: TopologyFullMesh}, 7, nil, func(int64) int { return 6 }},
+		{TopologyConfig{}, 4, nil, func(int64) int { return 3 }},
+		{TopologyConfig{Kind: TopologyRing}, 1, nil, func(int64) int { return 0 }},
+		{TopologyConfig{Kind: TopologyRing}, 2, nil, func(int64) int { return 1 }},
+		{TopologyConfig{Kind: TopologyRing}, 9, nil, func(int64) int { return 2 }},
+		{TopologyConfig{Kind: TopologyStar}, 6, nil, func(seq int64) int {
+			if seq == 1 {
+				return 5
+			}
+			return 1
+		}},
+		{TopologyConfig{Kind: TopologyStar}, 6, []int64{3, 5}, func(seq int64) int {
+			if seq == 3 || seq == 5 {
+				return 5
+			}
+			return 2
+		}},
+		{TopologyConfig{Kind: TopologyRandomRegular, Degree: 3, Seed: 1}, 10, nil, func(int64) int { return 3 }},
+		{TopologyConfig{Kind: TopologyRandomRegular, Degree: 4, Seed: 2}, 5, nil, func(int64) int { return 4 }},
+		{TopologyConfig{Kind: TopologyRandomRegular, Degree: 1, Seed: 3}, 8, nil, func(int64) int { return 1 }},
+		{TopologyConfig{Kind: TopologySmallWorld, Degree: 4}, 10, nil, func(int64) int { return 4 }},
+		{TopologyConfig{Kind: TopologySmallWorld, Degree: 2}, 3, nil, func(int64) int { return 2 }},
+		{TopologyConfig{Kind: TopologyNone}, 5, nil, func(int64) int { return 0 }},
+	}
+
+	for _, c := range cases {
+		label := string(c.cfg.Kind)
+		topo, err := NewTopology(c.cfg, c.n, c.hubs)
+		if err != nil {
+			t.Errorf("%s of %d: %s", label, c.n, err)
+			continue
+		}
+		n := int64(c.n)
+		checkSymmetric(t, label, topo, n)
+		for seq := int64(1); seq <= n; seq++ {
+			if got, expect := len(topo.Neighbors(seq)), c.degree(seq); got != expect {
+				t.Errorf("%s of %d: instance %d degree mismatch. expected: %d, got: %d", label, c.n, seq, expect, got)
+			}
+		}
+	}
+}
+
+func TestTopologyNeighbors(t *testing.T) {
+	cases := []struct {
+		cfg    TopologyConfig
+		n      int
+		seq    int64
+		expect []int64
+	}{
+		{TopologyConfig{Kind: TopologyFullMesh}, 4, 2, []int64{1, 3, 4}},
+		{TopologyConfig{Kind: TopologyRing}, 5, 1, []int64{2, 5}},
+		{TopologyConfig{Kind: TopologyRing}, 5, 3, []int64{2, 4}},
+		{TopologyConfig{Kind: TopologyStar}, 4, 1, []int64{2, 3, 4}},
+		{TopologyConfig{Kind: TopologyStar}, 4, 4, []int64{1}},
+		// without rewiring a small world is a ring lattice
+		{TopologyConfig{Kind: TopologySmallWorld, Degree: 4}, 6, 1, []int64{2, 3, 5, 6}},
+		{TopologyConfig{Kind: TopologySmallWorld, Degree: 2}, 6, 4, []int64{3, 5}},
+		{TopologyConfig{Kind: TopologyNone}, 3, 1, []int64{}},
+	}
+
+	for _, c := range cases {
+		topo, err := NewTopology(c.cfg, c.n, nil)
+		if err != nil {
+			t.Fatalf("%s of %d: %s", c.cfg.Kind, c.n, err)
+		}
+		if got := topo.Neighbors(c.seq); !reflect.DeepEqual(got, c.expect) {
+			t.Errorf("%s of %d: neighbours of %d mismatch. expected: %v, got: %v", c.cfg.Kind, c.n, c.seq, c.expect, got)
+		}
+	}
+}
+
+func TestTopologySmallWorldRewire(t *testing.T) {
+	for _, rewire := range []float64{0.2, 0.5, 1} {
+		for seed := int64(0); seed < 20; seed++ {
+			cfg := TopologyConfig{Kind: TopologySmallWorld, Degree: 4, Rewire: rewire, Seed: seed}
+			topo, err := NewTopology(cfg, 12, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkSymmetric(t, "small_world", topo, 12)
+			// rewiring moves edges, it never adds or drops them
+			if got := edgeCount(topo, 12); got != 12*4/2 {
+				t.Errorf("rewire %v seed %d: edge count mismatch. expected: %d, got: %d", rewire, seed, 12*4/2, got)
+			}
+		}
+	}
+}
+
+func TestTopologyRandomRegularSeeds(t *testing.T) {
+	for seed := int64(0); seed < 20; seed++ {
+		cfg := TopologyConfig{Kind: TopologyRandomRegular, Degree: 3, Seed: seed}
+		topo, err := NewTopology(cfg, 12, nil)
+		if err != nil {
+			t.Fatalf("seed %d: %s", seed, err)
+		}
+		checkSymmetric(t, "random_regular", topo, 12)
+		for seq := int64(1); seq <= 12; seq++ {
+			if got := len(topo.Neighbors(seq)); got != 3 {
+				t.Errorf("seed %d: instance %d degree mismatch. expected: 3, got: %d", seed, seq, got)
+			}
+		}
+	}
+}
+
+func TestTopologyDeterministic(t *testing.T) {
+	for _, kind := range []TopologyKind{TopologyRandomRegular, TopologySmallWorld} {
+		cfg := TopologyConfig{Kind: kind, Degree: 4, Rewire: 0.5, Seed: 42}
+		a, err := NewTopology(cfg, 16, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := NewTopology(cfg, 16, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for seq := int64(1); seq <= 16; seq++ {
+			if !reflect.DeepEqual(a.Neighbors(seq), b.Neighbors(seq)) {
+				t.Errorf("%s: instance %d neighbours differ between graphs with the same seed. %v != %v", kind, seq, a.Neighbors(seq), b.Neighbors(seq))
+			}
+		}
+	}
+}
+
+func TestTopologyErrors(t *testing.T) {
+	cases := []struct {
+		cfg TopologyConfig
+		n   int
+	}{
+		{TopologyConfig{Kind: "hypercube"}, 4},
+		// random regular degrees must be less than n, with an even product
+		{TopologyConfig{Kind: TopologyRandomRegular, Degree: 0}, 4},
+		{TopologyConfig{Kind: TopologyRandomRegular, Degree: 4}, 4},
+		{TopologyConfig{Kind: TopologyRandomRegular, Degree: 3}, 5},
+		// small world degrees must be between 2 & n-1
+		{TopologyConfig{Kind: TopologySmallWorld, Degree: 1}, 6},
+		{TopologyConfig{Kind: TopologySmallWorld, Degree: 6}, 6},
+	}
+
+	for _, c := range cases {
+		if _, err := NewTopology(c.cfg, c.n, nil); err == nil {
+			t.Errorf("expected %s of %d with degree %d to fail", c.cfg.Kind, c.n, c.cfg.Degree)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package plan
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	peer "github.com/libp2p/go-libp2p-peer"
+	"github.com/qri-io/dataset"
+	"github.com/qri-io/qri/dsref"
+	"github.com/qri-io/qri/lib"
+	"github.com/qri-io/test-plans/sim"
+)
+
+// PushToRemotes pushes all versions of the actor's dataset named dsName to
+// every remote in the actor's configuration, returning an error describing
+// each push that failed
+func (plan *Plan) PushToRemotes(ctx context.Context, dsName string) error {
+	remotes := plan.Actor.Inst.Config().Remotes
+	if remotes == nil {
+		return fmt.Errorf("This actor does not know of any remotes, are you sure it is a pusher?")
+	}
+
+	var accErr error
+	// iterate over each remote and attempt to push to each
+	for name := range *remotes {
+		if err := plan.PushToRemote(ctx, name, dsName); err != nil {
+			accErr = AccumulateErrors(accErr, err)
+		}
+	}
+	return accErr
+}
+
+// PushToRemote pushes all versions of the actor's dataset named dsName to the
+// remote named remoteName, signalling sim.StatePushSent once the attempt is
+// finished
+func (plan *Plan) PushToRemote(ctx context.Context, remoteName, dsName string) error {
+	err := plan.Push(ctx, remoteName, dsName)
+	if sigErr := plan.SignalPushSent(ctx); sigErr != nil {
+		return AccumulateErrors(err, sigErr)
+	}
+	return err
+}
+
+// SignalPushSent signals sim.StatePushSent, for callers of Push that signal
+// each push attempt themselves
+func (plan *Plan) SignalPushSent(ctx context.Context) error {
+	if _, err := plan.Client.SignalEntry(ctx, sim.StatePushSent); err != nil {
+		return fmt.Errorf("signalling push sent: %w", err)
+	}
+	return nil
+}
+
+// Push pushes all versions of the actor's dataset named dsName to the remote
+// named remoteName without signalling any sync state
+func (plan *Plan) Push(ctx context.Context, remoteName, dsName string) error {
+	rm := lib.NewRemoteMethods(plan.Actor.Inst)
+	pp := &lib.PushParams{
+		Ref:        fmt.Sprintf("%s/%s", plan.Actor.Peername(), dsName),
+		RemoteName: remoteName,
+		All:        true,
+	}
+	ref := &dsref.Ref{}
+	start := time.Now()
+	err := rm.Push(pp, ref)
+	plan.recordTransfer(ctx, pushMetrics, remoteName, time.Since(start), ref.Path, err)
+	if err != nil {
+		return fmt.Errorf("error pushing %q to %q: %w", pp.Ref, pp.RemoteName, err)
+	}
+	return nil
+}
+
+// PullFromRemotes pulls the dataset named dsName from every remote in the
+// actor's configuration, returning an error describing each pull that failed
+func (plan *Plan) PullFromRemotes(ctx context.Context, dsName string) error {
+	remotes := plan.Actor.Inst.Config().Remotes
+	if remotes == nil {
+		return fmt.Errorf("This actor does not know of any remotes, are you sure it is a puller?")
+	}
+
+	var accErr error
+	// iterate over each remote and attempt to pull from each
+	for name := range *remotes {
+		if err := plan.PullFromRemote(ctx, name, dsName); err != nil {
+			accErr = AccumulateErrors(accErr, err)
+		}
+	}
+	return accErr
+}
+
+// PullFromRemote pulls the dataset named dsName from the remote named
+// remoteName. remotes pull their own datasets, so the pulled reference is
+// remoteName/dsName
+func (plan *Plan) PullFromRemote(ctx context.Context, remoteName, dsName string) error {
+	remotes := plan.Actor.Inst.Config().Remotes
+	if remotes == nil {
+		return fmt.Errorf("This actor does not know of any remotes, are you sure it is a puller?")
+	}
+	stringID, ok := (*remotes)[remoteName]
+	if !ok {
+		return fmt.Errorf("unknown remote %q", remoteName)
+	}
+	id, err := peer.IDB58Decode(stringID)
+	if err != nil {
+		return fmt.Errorf("error parsing remote %q peer id %q: %s", remoteName, stringID, err)
+	}
+	remoteAddrs := plan.Actor.Inst.Node().Host().Peerstore().Addrs(id)
+	for _, addr := range remoteAddrs {
+		plan.Runenv.RecordMessage("remote addr: %s", addr)
+	}
+	if len(remoteAddrs) < 1 {
+		return fmt.Errorf("remote %s has no addrs", remoteName)
+	}
+
+	dm := lib.NewDatasetMethods(plan.Actor.Inst)
+	pp := &lib.PullParams{
+		Ref:        fmt.Sprintf("%s/%s", remoteName, dsName),
+		RemoteAddr: remoteAddrs[0].String(),
+	}
+	ds := &dataset.Dataset{}
+	start := time.Now()
+	err = dm.Pull(pp, ds)
+	plan.recordTransfer(ctx, pullMetrics, remoteName, time.Since(start), ds.Path, err)
+	if err != nil {
+		return fmt.Errorf("error pulling %q from %q: %w", pp.Ref, remoteName, err)
+	}
+	return nil
+}
+
+// RecordForeignLogs writes a message for each dataset log in the actor's
+// logbook that belongs to another peer, returning the number of logs found
+func (plan *Plan) RecordForeignLogs(ctx context.Context) (int, error) {
+	plan.Runenv.RecordMessage("Listing all foreign logs:")
+	logs, err := plan.Actor.Inst.Repo().Logbook().ListAllLogs(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("error listing all logs: %s", err)
+	}
+	count := 0
+	for _, log := range logs {
+		if log.Name() == plan.Actor.Peername() {
+			continue
+		}
+		ref := fmt.Sprintf("%s@%s", log.Name(), log.Author())
+		for _, l := range log.Logs {
+			plan.Runenv.RecordMessage("   %s/%s", ref, l.Name())
+			count++
+		}
+	}
+	return count, nil
+}
+
+// AccumulateErrors appends newError to errors, one error per line. errors may
+// be nil
+func AccumulateErrors(errors, newError error) error {
+	if errors == nil {
+		return newError
+	}
+	return fmt.Errorf("%s\n%s", errors.Error(), newError.Error())
+}
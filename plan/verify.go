@@ -0,0 +1,93 @@
+package plan
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/qri-io/qri/dsref"
+	"github.com/testground/sdk-go/sync"
+)
+
+// PublishedDataset describes a dataset version as the actor that saved it
+// sees it. Actors that receive the dataset compare their copy against it
+type PublishedDataset struct {
+	Peername  string
+	Name      string
+	Path      string
+	BodyPath  string
+	Signature string
+}
+
+// PublishedDatasetTopic is the topic dataset sources publish to
+var PublishedDatasetTopic = sync.NewTopic("published-dataset", &PublishedDataset{})
+
+// PublishDataset shares the path, body path & commit signature of the head of
+// one of the actor's datasets, so instances that push or pull it can check
+// they hold the same version
+func (plan *Plan) PublishDataset(ctx context.Context, name string) error {
+	ref := &dsref.Ref{Username: plan.Actor.Peername(), Name: name}
+	ds, err := plan.Actor.ReadDataset(ctx, ref)
+	if err != nil {
+		return err
+	}
+
+	pub := &PublishedDataset{
+		Peername: ref.Username,
+		Name:     ref.Name,
+		Path:     ref.Path,
+		BodyPath: ds.BodyPath,
+	}
+	if ds.Commit != nil {
+		pub.Signature = ds.Commit.Signature
+	}
+	if _, err := plan.Client.Publish(ctx, PublishedDatasetTopic, pub); err != nil {
+		return fmt.Errorf("publishing dataset %s: %w", ref.Human(), err)
+	}
+	return nil
+}
+
+// VerifyPublishedDatasets waits for numDatasets datasets to be published,
+// asserting the actor's copy of each one matches the source's
+func (plan *Plan) VerifyPublishedDatasets(ctx context.Context, numDatasets int) error {
+	ch := make(chan *PublishedDataset)
+	sub, err := plan.Client.Subscribe(ctx, PublishedDatasetTopic, ch)
+	if err != nil {
+		return fmt.Errorf("published dataset subscription failure: %w", err)
+	}
+
+	for i := 0; i < numDatasets; i++ {
+		select {
+		case pub := <-ch:
+			plan.Assert("dataset_matches_source", plan.compareDataset(ctx, pub))
+		case err := <-sub.Done():
+			return err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// compareDataset checks the actor's copy of a published dataset has the same
+// path, body & commit signature
+func (plan *Plan) compareDataset(ctx context.Context, pub *PublishedDataset) error {
+	ref := &dsref.Ref{Username: pub.Peername, Name: pub.Name}
+	ds, err := plan.Actor.ReadDataset(ctx, ref)
+	if err != nil {
+		return err
+	}
+	if ref.Path != pub.Path {
+		return fmt.Errorf("%s head is %q, source's head is %q", ref.Human(), ref.Path, pub.Path)
+	}
+	if ds.BodyPath != pub.BodyPath {
+		return fmt.Errorf("%s body is %q, source's body is %q", ref.Human(), ds.BodyPath, pub.BodyPath)
+	}
+	signature := ""
+	if ds.Commit != nil {
+		signature = ds.Commit.Signature
+	}
+	if signature != pub.Signature {
+		return fmt.Errorf("%s commit signature doesn't match the source's", ref.Human())
+	}
+	return nil
+}
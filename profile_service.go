@@ -15,8 +15,11 @@ import (
 
 var doneRecievingProfiles = sync.State("done receiving profiles")
 
-// RunPlanProfileService creates an instance, connects to each instance, waits
-// for the profile exchange to finish, and lists all the known profiles
+// RunPlanProfileService creates an instance, connects to its neighbours in the
+// configured topology, waits for the profile exchange to finish, and lists all
+// the known profiles. with the none topology instances dial no one, so they
+// wait out profile_service_timeout_sec for peers found through discovery &
+// record how many they found
 func RunPlanProfileService(ctx context.Context, p *plan.Plan) error {
 	var (
 		qriPeerConnCh     = make(chan profile.ID)
@@ -24,20 +27,36 @@ func RunPlanProfileService(ctx context.Context, p *plan.Plan) error {
 		profileWait       = make(chan struct{})
 		profileServiceCtx context.Context
 	)
-	defer func() {
-		close(qriPeerConnCh)
-		close(profileWait)
-	}()
+	// qriPeerConnCh is never closed, the event handler may still be sending
+	// on it after the run is over
+	defer close(profileWait)
 
 	if err := p.SetupNetwork(ctx); err != nil {
 		return err
 	}
 
+	// instances exchange profiles with the neighbours they're connected to
+	topo, err := p.Topology()
+	if err != nil {
+		return err
+	}
+	expectPeers := len(topo.Neighbors(p.Seq))
+	discover := topo.Kind == plan.TopologyNone
+	if discover {
+		// stop early only if discovery finds every other instance
+		expectPeers = p.Runenv.TestInstanceCount - 1
+	}
+
 	timeout := p.Runenv.IntParam("profile_service_timeout_sec")
 	profileServiceCtx, cancel := context.WithTimeout(ctx, time.Duration(timeout)*time.Second)
 	defer cancel()
 
 	go func() {
+		// instances without neighbours have no profiles to wait for
+		if expectPeers == 0 {
+			profileWait <- struct{}{}
+			return
+		}
 		for {
 			select {
 			case ProfileService := <-qriPeerConnCh:
@@ -49,13 +68,17 @@ func RunPlanProfileService(ctx context.Context, p *plan.Plan) error {
 				}
 				if !ok {
 					connectedQriPeers = append(connectedQriPeers, ProfileService)
-					if len(connectedQriPeers) == p.Runenv.TestGroupInstanceCount-1 {
+					if len(connectedQriPeers) == expectPeers {
 						profileWait <- struct{}{}
 						return
 					}
 				}
 			case <-profileServiceCtx.Done():
-				p.Runenv.RecordFailure(fmt.Errorf("context timed out before all profiles were recieved"))
+				if discover {
+					p.Runenv.RecordMessage("discovered %d of %d qri peers before the timeout", len(connectedQriPeers), expectPeers)
+				} else {
+					p.Runenv.RecordFailure(fmt.Errorf("context timed out before all profiles were recieved"))
+				}
 				profileWait <- struct{}{}
 				return
 			}
@@ -73,9 +96,16 @@ func RunPlanProfileService(ctx context.Context, p *plan.Plan) error {
 	if _, err := p.DialOtherPeers(ctx); err != nil {
 		p.Runenv.RecordFailure(err)
 	}
+	if err := p.SnapshotConnections(ctx, "dialed"); err != nil {
+		p.Runenv.RecordMessage("error snapshotting connections: %s", err)
+	}
+	if err := p.RecordBandwidth(ctx, "dialed"); err != nil {
+		p.Runenv.RecordMessage("error recording bandwidth: %s", err)
+	}
 
 	p.Runenv.RecordMessage("waiting to connect to all qri nodes")
 	<-profileWait
+	p.RecordPoint("qri_peers_connected", float64(len(connectedQriPeers)))
 	if err := listAllKnownProfiles(ctx, p); err != nil {
 		p.Runenv.RecordFailure(err)
 	}
@@ -84,12 +114,18 @@ func RunPlanProfileService(ctx context.Context, p *plan.Plan) error {
 	p.Client.MustSignalEntry(ctx, doneRecievingProfiles)
 	sendAttempts := p.Runenv.TestInstanceCount
 	<-p.Client.MustBarrier(ctx, doneRecievingProfiles, sendAttempts).C
+	if err := p.SnapshotConnections(ctx, "profiles exchanged"); err != nil {
+		p.Runenv.RecordMessage("error snapshotting connections: %s", err)
+	}
+	if err := p.RecordBandwidth(ctx, "profiles exchanged"); err != nil {
+		p.Runenv.RecordMessage("error recording bandwidth: %s", err)
+	}
 
-	return <-p.Finished(ctx)
+	return p.Outcome(ctx)
 }
 
 func profileServiceEventHandler(ctx context.Context, p *plan.Plan, qriPeerConnCh chan profile.ID) event.Handler {
-	return func(ctx context.Context, t event.Type, payload interface{}) error {
+	return func(_ context.Context, t event.Type, payload interface{}) error {
 		pro, ok := payload.(*profile.Profile)
 		if !ok {
 			err := fmt.Errorf("unexpected event payload, expected type *profile.Profile")
@@ -99,7 +135,12 @@ func profileServiceEventHandler(ctx context.Context, p *plan.Plan, qriPeerConnCh
 		switch t {
 		case event.ETP2PQriPeerConnected:
 			p.Runenv.RecordMessage("Profile exchange request received from %q", pro.Peername)
-			qriPeerConnCh <- pro.ID
+			// peers that connect after every profile was received have no
+			// one to hear them, so give up once the plan is done
+			select {
+			case qriPeerConnCh <- pro.ID:
+			case <-ctx.Done():
+			}
 			return nil
 		default:
 			err := fmt.Errorf("unexpected event type: %s", t)
@@ -143,6 +184,7 @@ func listAllKnownProfiles(ctx context.Context, p *plan.Plan) error {
 		msg += fmt.Sprintf("\n  %s, %s", profile.Peername, id)
 	}
 	p.Runenv.RecordMessage(msg)
+	p.RecordPoint("profiles_known", float64(len(profileList)))
 	p.ActorFinished(ctx)
 	return nil
 }
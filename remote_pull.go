@@ -4,9 +4,6 @@ import (
 	"context"
 	"fmt"
 
-	peer "github.com/libp2p/go-libp2p-peer"
-	"github.com/qri-io/dataset"
-	"github.com/qri-io/qri/config"
 	"github.com/qri-io/qri/dsref"
 	"github.com/qri-io/qri/lib"
 	"github.com/qri-io/test-plans/plan"
@@ -17,6 +14,11 @@ var pullDatasetName = "megajoules"
 var defaultPullDatasetSize = 1000
 var defaultPullersPerRemote = 1
 
+const (
+	rolePuller = "puller"
+	roleRemote = "remote"
+)
+
 // RunPlanRemotePull demonstrates test output functions
 // This method emits two Messages and one Metric
 func RunPlanRemotePull(ctx context.Context, p *plan.Plan) error {
@@ -24,14 +26,19 @@ func RunPlanRemotePull(ctx context.Context, p *plan.Plan) error {
 	if pullersPerRemote >= p.Runenv.TestInstanceCount {
 		return fmt.Errorf("Pull variable specify %d puller per receiver, but there are only %d instances", pullersPerRemote, p.Runenv.TestInstanceCount)
 	}
+	if err := p.AssignRoles(
+		plan.Role{Name: rolePuller, Weight: pullersPerRemote},
+		plan.Role{Name: roleRemote, Weight: 1},
+	); err != nil {
+		return err
+	}
 	if err := p.SetupNetwork(ctx); err != nil {
 		return err
 	}
-
-	isRemote := p.Seq%(int64(pullersPerRemote+1)) == 0
+	isRemote := p.Role() == roleRemote
 
 	var constructor plan.ActorConstructor
-	// even actors pull, odd actors receive
+	// pullers pull, remotes serve
 	if isRemote {
 		constructor = newRemote
 	} else {
@@ -46,6 +53,9 @@ func RunPlanRemotePull(ctx context.Context, p *plan.Plan) error {
 	if err := p.ShareInfo(ctx); err != nil {
 		return err
 	}
+	if err := p.RecordBandwidth(ctx, "setup"); err != nil {
+		p.Runenv.RecordMessage("error recording bandwidth: %s", err)
+	}
 
 	var executeActions actorActions
 	if isRemote {
@@ -53,11 +63,17 @@ func RunPlanRemotePull(ctx context.Context, p *plan.Plan) error {
 	} else {
 		executeActions = pullerActions
 	}
+	// churn the network, if configured, while actions run
+	churn := p.StartChurn(ctx)
 	if err := executeActions(ctx, p); err != nil {
 		p.Runenv.RecordFailure(err)
 	}
+	churn.Stop()
+	if err := p.RecordBandwidth(ctx, "actions"); err != nil {
+		p.Runenv.RecordMessage("error recording bandwidth: %s", err)
+	}
 
-	return <-p.Finished(ctx)
+	return p.Outcome(ctx)
 }
 
 func getPullersPerRemote(p *plan.Plan) int {
@@ -83,18 +99,8 @@ func newPuller(ctx context.Context, p *plan.Plan) (*sim.Actor, error) {
 	// and what should belong in the testcase specific package, let's leave
 	// this here. Potentially, sim should allow the testcase to specify what it
 	// is sharing when we `ShareInfo` and how we want to store it.
-	receiversNum := p.Runenv.TestInstanceCount / (getPullersPerRemote(p) + 1)
-	p.Runenv.RecordMessage("waiting for remote info")
-	<-p.Client.MustBarrier(ctx, remoteInfoSent, receiversNum).C
-
-	rtCh := make(chan *remoteInfo)
-	p.Client.Subscribe(ctx, rt, rtCh)
-
-	act.Inst.Config().Remotes = &config.Remotes{}
-	for i := 0; i < receiversNum; i++ {
-		r := <-rtCh
-		act.Inst.Config().Remotes.SetArbitrary(r.Peername, r.PeerID)
-		p.Runenv.RecordMessage("received remote info from %q", r.Peername)
+	if err := p.ReceiveRemoteInfo(ctx, act, p.Roles.Count(roleRemote)); err != nil {
+		return nil, err
 	}
 
 	p.Runenv.RecordMessage("I'm a Puller named %s", act.Peername())
@@ -115,7 +121,7 @@ func newRemote(ctx context.Context, p *plan.Plan) (*sim.Actor, error) {
 		return nil, err
 	}
 
-	if err := act.GenerateDatasetVersion(pullDatasetName, getDatasetSize(p)); err != nil {
+	if err := generateDatasetHistory(ctx, p, act, pullDatasetName); err != nil {
 		return nil, err
 	}
 
@@ -127,69 +133,24 @@ func newRemote(ctx context.Context, p *plan.Plan) (*sim.Actor, error) {
 	p.Runenv.RecordMessage("My qri ID is %s", act.ID())
 	p.Runenv.RecordMessage("My peer ID is %s", act.AddrInfo().ID)
 
-	pro, err := act.Inst.Repo().Profile()
-	if err != nil {
-		return nil, err
-	}
-
 	// TODO (ramfox): this feels a bit redundant! didn't we just send info??
 	// well, until we know better what should belong in the `sim` package
 	// and what should belong in the testcase specific package, let's leave
 	// this here. Potentially, sim should allow the testcase to specify what it
 	// is sharing when we `ShareInfo` and how we want to store it.
-	p.Runenv.RecordMessage("Sending my remote info")
-	// id := act.AddrInfo().ID.String()
-	// p.Runenv.RecordMessage("id = %q", id)
-	// if _, err := peer.IDFromString(id); err != nil {
-	// 	p.Runenv.RecordMessage("cannot parse id after stringifying!")
-	// }
-	p.Client.Publish(ctx, rt, &remoteInfo{
-		Peername: pro.Peername,
-		PeerID:   act.AddrInfo().ID.Pretty(),
-	})
-	p.Client.MustSignalEntry(ctx, remoteInfoSent)
+	if err := p.PublishRemoteInfo(ctx, act); err != nil {
+		return nil, err
+	}
 
 	return act, err
 }
 
 func pullFromAllRemotes(ctx context.Context, p *plan.Plan) error {
-	remotes := p.Actor.Inst.Config().Remotes
-	if remotes == nil {
-		return fmt.Errorf("This actor does not know of any remotes, are you sure it is a puller?")
-	}
-
-	// create remote methods
-	dm := lib.NewDatasetMethods(p.Actor.Inst)
-	var accErr error
-
-	// iterate over each remote and attempt to pull to sssseach
-	for name, stringID := range *remotes {
-		id, err := peer.IDB58Decode(stringID)
-		if err != nil {
-			accErr = accumulateErrors(accErr, fmt.Errorf("error parsing remote %q peer id %q: %s", name, stringID, err))
-			continue
-		}
-		remoteAddrs := p.Actor.Inst.Node().Host().Peerstore().Addrs(id)
-		for _, addr := range remoteAddrs {
-			p.Runenv.RecordMessage("remote addr: %s", addr)
-		}
-		if len(remoteAddrs) < 1 {
-			accErr = accumulateErrors(accErr, fmt.Errorf("remote %s has no addrs", name))
-			continue
-		}
-		pp := &lib.PullParams{
-			Ref:        fmt.Sprintf("%s/%s", name, pullDatasetName),
-			RemoteAddr: remoteAddrs[0].String(),
-		}
-		ds := &dataset.Dataset{}
-		if err := dm.Pull(pp, ds); err != nil {
-			accErr = accumulateErrors(accErr, fmt.Errorf("error pulling %q from %q: %s", pp.Ref, name, err))
-		}
-	}
+	accErr := p.PullFromRemotes(ctx, pullDatasetName)
 	// signal a pull attempt has been made
 	p.Client.MustSignalEntry(ctx, sim.StatePullAttempted)
 	p.Runenv.RecordMessage("attempted pull from all remotes")
-	p.ActorFinished(ctx)
+	p.RecordLogbookSize()
 	return accErr
 }
 
@@ -197,53 +158,49 @@ func pullFromAllRemotes(ctx context.Context, p *plan.Plan) error {
 // - announce it is about to pull
 // - pull a dataset from all remotes on the remote list
 // - announce it is finished pulling
+// - assert it holds one dataset from each remote, matching the remote's copy
 func pullerActions(ctx context.Context, p *plan.Plan) error {
 	p.Runenv.RecordMessage("About to pull from remotes")
 	if err := pullFromAllRemotes(ctx, p); err != nil {
-		return err
+		p.Runenv.RecordFailure(err)
 	}
 	p.Runenv.RecordMessage("Finished pulling")
-	p.Runenv.RecordMessage("Listing all foreign logs:")
-	logs, err := p.Actor.Inst.Repo().Logbook().ListAllLogs(ctx)
-	if err != nil {
-		return fmt.Errorf("error listing all logs: %s", err)
+	if _, err := p.RecordForeignLogs(ctx); err != nil {
+		return err
 	}
-	for _, log := range logs {
-		if log.Name() == p.Actor.Peername() {
-			continue
-		}
-		ref := fmt.Sprintf("%s@%s", log.Name(), log.Author())
-		for _, l := range log.Logs {
-			p.Runenv.RecordMessage("   %s/%s", ref, l.Name())
-		}
+	numRemotes := p.Roles.Count(roleRemote)
+	p.Assert("foreign_datasets", p.ExpectForeignDatasets(ctx, numRemotes, numRemotes))
+	if err := p.VerifyPublishedDatasets(ctx, numRemotes); err != nil {
+		return err
 	}
 	p.ActorFinished(ctx)
 	return nil
 }
 
 // remoteActions execute the actions that the receiver should take:
+// - assert it can resolve its own dataset
+// - publish its dataset so pullers can verify their copy
 // - announce it is waiting for dataset pulls
-// - wait until all pulls have happened
+// - wait until every puller has finished pulling
+// - assert it served a pull to every puller
 // - announce closing
 func remoteActions(ctx context.Context, p *plan.Plan) error {
-	ref := &dsref.Ref{
+	ref := dsref.Ref{
 		Username: p.Actor.Peername(),
 		Name:     pullDatasetName,
 	}
-	source, err := p.Actor.Inst.ResolveReference(ctx, ref, "local")
-	if err != nil {
-		p.Runenv.RecordFailure(fmt.Errorf("cannot resolve ref, source: %q, err: %s", source, err))
-	} else {
-		p.Runenv.RecordMessage("able to resolve own reference: %v", ref)
-		if !ref.Complete() {
-			p.Runenv.RecordFailure(fmt.Errorf("ref not complete"))
-		}
+	p.Assert("own_dataset", p.ExpectDataset(ctx, ref, ""))
+	if err := p.PublishDataset(ctx, pullDatasetName); err != nil {
+		return err
 	}
 	p.Runenv.RecordMessage("Waiting for dataset pulls")
-	numOfPullers := p.Runenv.TestInstanceCount - (p.Runenv.TestGroupInstanceCount / (getPullersPerRemote(p) + 1))
-	<-p.Client.MustBarrier(ctx, sim.StatePullAttempted, numOfPullers).C
+	numPullers := p.Roles.Count(rolePuller)
+	// pullers signal once they've tried every remote, whether their pulls
+	// succeeded or not, so a failed pull can't leave remotes waiting
+	<-p.Client.MustBarrier(ctx, sim.StatePullAttempted, numPullers).C
 
 	p.Runenv.RecordMessage("Finished waiting")
+	p.Assert("pulls_served", checkCount("pulls served", p.Actor.Hooks().PullsServed(), numPullers))
 	p.ActorFinished(ctx)
 	return nil
 
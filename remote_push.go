@@ -5,18 +5,22 @@ import (
 	"fmt"
 
 	"github.com/libp2p/go-libp2p-core/peer"
-	"github.com/qri-io/qri/config"
-	"github.com/qri-io/qri/dsref"
 	"github.com/qri-io/qri/event"
 	"github.com/qri-io/qri/lib"
 	"github.com/qri-io/qri/repo/profile"
 	"github.com/qri-io/test-plans/plan"
 	"github.com/qri-io/test-plans/sim"
-	"github.com/testground/sdk-go/sync"
 )
 
 var datasetName = "megajoules"
-var defaultDatasetSize = 1000
+
+const (
+	rolePusher   = "pusher"
+	roleReceiver = "receiver"
+)
+
+var defaultDatasetRows = 1000
+var defaultDatasetVersions = 1
 var defaultPushersPerReceiver = 1
 
 // RunPlanRemotePushPull demonstrates test output functions
@@ -26,14 +30,19 @@ func RunPlanRemotePushPull(ctx context.Context, p *plan.Plan) error {
 	if pushersPerReceiver >= p.Runenv.TestInstanceCount {
 		return fmt.Errorf("Push variable specify %d pusher per receiver, but there are only %d instances", pushersPerReceiver, p.Runenv.TestInstanceCount)
 	}
+	if err := p.AssignRoles(
+		plan.Role{Name: rolePusher, Weight: pushersPerReceiver},
+		plan.Role{Name: roleReceiver, Weight: 1},
+	); err != nil {
+		return err
+	}
 	if err := p.SetupNetwork(ctx); err != nil {
 		return err
 	}
-
-	isReceiver := p.Seq%(int64(pushersPerReceiver+1)) == 0
+	isReceiver := p.Role() == roleReceiver
 
 	var constructor plan.ActorConstructor
-	// even actors push, odd actors receive
+	// pushers push, receivers receive
 	if isReceiver {
 		constructor = newReceiver
 	} else {
@@ -48,6 +57,9 @@ func RunPlanRemotePushPull(ctx context.Context, p *plan.Plan) error {
 	if err := p.ShareInfo(ctx); err != nil {
 		return err
 	}
+	if err := p.RecordBandwidth(ctx, "setup"); err != nil {
+		p.Runenv.RecordMessage("error recording bandwidth: %s", err)
+	}
 
 	var executeActions actorActions
 	if isReceiver {
@@ -55,10 +67,16 @@ func RunPlanRemotePushPull(ctx context.Context, p *plan.Plan) error {
 	} else {
 		executeActions = pusherActions
 	}
+	// churn the network, if configured, while actions run
+	churn := p.StartChurn(ctx)
 	if err := executeActions(ctx, p); err != nil {
 		p.Runenv.RecordFailure(err)
 	}
-	return <-p.Finished(ctx)
+	churn.Stop()
+	if err := p.RecordBandwidth(ctx, "actions"); err != nil {
+		p.Runenv.RecordMessage("error recording bandwidth: %s", err)
+	}
+	return p.Outcome(ctx)
 }
 
 var eventsToHandle = []event.Type{
@@ -89,6 +107,14 @@ func eventHandler(ctx context.Context, p *plan.Plan) event.Handler {
 	}
 }
 
+// checkCount errors if got doesn't match expect
+func checkCount(what string, got, expect int) error {
+	if got != expect {
+		return fmt.Errorf("expected %d %s, found %d", expect, what, got)
+	}
+	return nil
+}
+
 func getPushersPerReceiver(p *plan.Plan) int {
 	ppr := p.Runenv.IntParam("pushersPerReceiver")
 	if ppr < 1 {
@@ -97,25 +123,64 @@ func getPushersPerReceiver(p *plan.Plan) int {
 	return ppr
 }
 
-func getDatasetSize(p *plan.Plan) int {
-	datasetSize := p.Runenv.IntParam("datasetSize")
-	if datasetSize < 1 {
-		return defaultDatasetSize
+// getDatasetRows returns the number of rows in generated datasets, set by the
+// datasetRows param
+func getDatasetRows(p *plan.Plan) int {
+	if p.Cfg.DatasetRows < 1 {
+		return defaultDatasetRows
 	}
-	return datasetSize
+	return p.Cfg.DatasetRows
 }
 
-// remoteInfo contains the details needed for the pusher to connect to the
-// remote. When we create a `newReceiver`, we broadcast the receiver's
-// `remoteInfo` over the `rt` ("remote-info") topic when we create a
-// `newPusher`, we subscribe to the `rt` topic to get each remote's info
-type remoteInfo struct {
-	Peername string // qri username
-	PeerID   string // peerID associated with the remote
+// getDatasetGeneratorRows returns the number of rows gen should create. a
+// datasetBytes param takes precedence over a row count
+func getDatasetGeneratorRows(p *plan.Plan, gen sim.DatasetGenerator) (int, error) {
+	if p.Cfg.DatasetBytes > 0 {
+		return sim.RowsForBytes(gen, p.Cfg.DatasetBytes)
+	}
+	return getDatasetRows(p), nil
 }
 
-var rt = sync.NewTopic("remote-info", &remoteInfo{})
-var remoteInfoSent = sync.State("remote info sent")
+// getDatasetVersions returns the length of generated dataset histories, set
+// by the datasetVersions param
+func getDatasetVersions(p *plan.Plan) int {
+	if p.Cfg.DatasetVersions < 1 {
+		return defaultDatasetVersions
+	}
+	return p.Cfg.DatasetVersions
+}
+
+func getDatasetMutation(p *plan.Plan) (sim.Mutation, error) {
+	if !p.Runenv.IsParamSet("datasetMutation") {
+		return sim.MutationAppend, nil
+	}
+	return sim.ParseMutation(p.Runenv.StringParam("datasetMutation"))
+}
+
+func getDatasetGenerator(p *plan.Plan, act *sim.Actor) (sim.DatasetGenerator, error) {
+	return act.NewDatasetGenerator(sim.DatasetShape(p.Cfg.DatasetShape))
+}
+
+// generateDatasetHistory saves the dataset history configured by test params
+// & records stats describing the head version
+func generateDatasetHistory(ctx context.Context, p *plan.Plan, act *sim.Actor, name string) error {
+	mutation, err := getDatasetMutation(p)
+	if err != nil {
+		return err
+	}
+	gen, err := getDatasetGenerator(p, act)
+	if err != nil {
+		return err
+	}
+	rows, err := getDatasetGeneratorRows(p, gen)
+	if err != nil {
+		return err
+	}
+	if err := act.GenerateDatasetHistory(name, gen, rows, getDatasetVersions(p), mutation); err != nil {
+		return err
+	}
+	return p.RecordDatasetStats(ctx, act, name)
+}
 
 func newPusher(ctx context.Context, p *plan.Plan) (*sim.Actor, error) {
 	act, err := sim.NewActor(ctx, p.Runenv, p.Client, p.Seq, lib.OptEventHandler(eventHandler(ctx, p), eventsToHandle...))
@@ -123,7 +188,7 @@ func newPusher(ctx context.Context, p *plan.Plan) (*sim.Actor, error) {
 		return nil, err
 	}
 
-	if err := act.GenerateDatasetVersion(datasetName, getDatasetSize(p)); err != nil {
+	if err := generateDatasetHistory(ctx, p, act, datasetName); err != nil {
 		return nil, err
 	}
 
@@ -136,18 +201,8 @@ func newPusher(ctx context.Context, p *plan.Plan) (*sim.Actor, error) {
 	// and what should belong in the testcase specific package, let's leave
 	// this here. Potentially, sim should allow the testcase to specify what it
 	// is sharing when we `ShareInfo` and how we want to store it.
-	receiversNum := p.Runenv.TestInstanceCount / (getPushersPerReceiver(p) + 1)
-	p.Runenv.RecordMessage("waiting for remote info")
-	<-p.Client.MustBarrier(ctx, remoteInfoSent, receiversNum).C
-
-	rtCh := make(chan *remoteInfo)
-	p.Client.Subscribe(ctx, rt, rtCh)
-
-	act.Inst.Config().Remotes = &config.Remotes{}
-	for i := 0; i < receiversNum; i++ {
-		r := <-rtCh
-		act.Inst.Config().Remotes.SetArbitrary(r.Peername, r.PeerID)
-		p.Runenv.RecordMessage("received remote info from %q", r.Peername)
+	if err := p.ReceiveRemoteInfo(ctx, act, p.Roles.Count(roleReceiver)); err != nil {
+		return nil, err
 	}
 
 	p.Runenv.RecordMessage("I'm a Pusher named %s", act.Peername())
@@ -176,33 +231,18 @@ func newReceiver(ctx context.Context, p *plan.Plan) (*sim.Actor, error) {
 	p.Runenv.RecordMessage("My qri ID is %s", act.ID())
 	p.Runenv.RecordMessage("My peer ID is %s", act.AddrInfo().ID)
 
-	pro, err := act.Inst.Repo().Profile()
-	if err != nil {
-		return nil, err
-	}
-
 	// TODO (ramfox): this feels a bit redundant! didn't we just send info??
 	// well, until we know better what should belong in the `sim` package
 	// and what should belong in the testcase specific package, let's leave
 	// this here. Potentially, sim should allow the testcase to specify what it
 	// is sharing when we `ShareInfo` and how we want to store it.
-	p.Runenv.RecordMessage("Sending my remote info")
-	p.Client.Publish(ctx, rt, &remoteInfo{
-		Peername: pro.Peername,
-		PeerID:   act.AddrInfo().ID.String(),
-	})
-	p.Client.MustSignalEntry(ctx, remoteInfoSent)
+	if err := p.PublishRemoteInfo(ctx, act); err != nil {
+		return nil, err
+	}
 
 	return act, err
 }
 
-func accumulateErrors(errors, newError error) error {
-	if errors == nil {
-		return newError
-	}
-	return fmt.Errorf("%s\n%s", errors.Error(), newError.Error())
-}
-
 // actorActions are the actions an actor should take during the test, specific
 // to the kind of actor it is, aka pusher or receiver
 type actorActions func(context.Context, *plan.Plan) error
@@ -210,64 +250,47 @@ type actorActions func(context.Context, *plan.Plan) error
 // pusherActions execute the actions that the pusher should take:
 // - announce it is about to push
 // - push a dataset to all remotes on the remote list
+// - publish the pushed version so receivers can verify their copy
 func pusherActions(ctx context.Context, p *plan.Plan) error {
 	p.Runenv.RecordMessage("About to push to remote")
-	remotes := p.Actor.Inst.Config().Remotes
-	if remotes == nil {
-		return fmt.Errorf("This actor does not know of any remotes, are you sure it is a pusher?")
-	}
-
-	// create remote methods
-	rm := lib.NewRemoteMethods(p.Actor.Inst)
-	var accErr error
-
-	// iterate over each remote and attempt to push to each
-	for name := range *remotes {
-		pp := &lib.PushParams{
-			Ref:        fmt.Sprintf("%s/%s", p.Actor.Peername(), datasetName),
-			RemoteName: name,
-			All:        true,
-		}
-		ref := &dsref.Ref{}
-		if err := rm.Push(pp, ref); err != nil {
-			accErr = accumulateErrors(accErr, fmt.Errorf("error pushing %q to %q: %s", pp.Ref, pp.RemoteName, err))
-		}
+	if err := p.PushToRemotes(ctx, datasetName); err != nil {
+		p.Runenv.RecordFailure(err)
 	}
-	if accErr != nil {
-		p.Runenv.RecordFailure(accErr)
+	if err := p.PublishDataset(ctx, datasetName); err != nil {
+		p.Runenv.RecordFailure(err)
 	}
 	// signal a push attempt has been made
 	p.Client.MustSignalEntry(ctx, sim.StatePushAttempted)
 	p.Runenv.RecordMessage("pushed to all remotes")
+	p.RecordLogbookSize()
 	p.ActorFinished(ctx)
 	return nil
 }
 
 // receiverActions execute the actions that the receiver should take:
 // - announce it is waiting for dataset
-// - wait until the expected number of datasets have attempted to be sent
+// - wait until every pusher has tried to push to every receiver
 // - announce we are finished waiting
+// - assert it received a push from every pusher
 // - list all logs in its logbook
+// - assert it holds one dataset from each pusher, matching the pusher's copy
 func receiverActions(ctx context.Context, p *plan.Plan) error {
+	numPushers := p.Roles.Count(rolePusher)
 	p.Runenv.RecordMessage("Waiting for dataset")
-	numOfPushers := p.Runenv.TestInstanceCount - (p.Runenv.TestGroupInstanceCount / (getPushersPerReceiver(p) + 1))
-	<-p.Client.MustBarrier(ctx, sim.StatePushAttempted, numOfPushers).C
+	// pushers signal once per push, whether it succeeded or not, so a failed
+	// push can't leave receivers waiting for a dataset that never arrives
+	<-p.Client.MustBarrier(ctx, sim.StatePushSent, numPushers*p.Roles.Count(roleReceiver)).C
 
 	p.Runenv.RecordMessage("Finished waiting")
-	p.Runenv.RecordMessage("Listing all foreign logs:")
-	logs, err := p.Actor.Inst.Repo().Logbook().ListAllLogs(ctx)
-	if err != nil {
-		return fmt.Errorf("error listing all logs: %s", err)
+	p.Assert("pushes_received", checkCount("pushes received", p.Actor.Hooks().PushesReceived(), numPushers))
+	if _, err := p.RecordForeignLogs(ctx); err != nil {
+		return err
 	}
-	for _, log := range logs {
-		if log.Name() == p.Actor.Peername() {
-			continue
-		}
-		ref := fmt.Sprintf("%s@%s", log.Name(), log.Author())
-		for _, l := range log.Logs {
-			p.Runenv.RecordMessage("   %s/%s", ref, l.Name())
-		}
+	p.Assert("foreign_datasets", p.ExpectForeignDatasets(ctx, numPushers, numPushers))
+	if err := p.VerifyPublishedDatasets(ctx, numPushers); err != nil {
+		return err
 	}
+	p.RecordLogbookSize()
 	p.ActorFinished(ctx)
 	return nil
 }
@@ -0,0 +1,335 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/qri-io/qri/dsref"
+	"github.com/qri-io/qri/lib"
+	reporef "github.com/qri-io/qri/repo/ref"
+	"github.com/qri-io/test-plans/plan"
+	"github.com/qri-io/test-plans/sim"
+	"github.com/testground/sdk-go/sync"
+)
+
+// remove metric names
+const (
+	metricRemoveDuration    = "remove_duration_ms"
+	metricRemoveSuccess     = "remove_success"
+	metricRemoveHookCalls   = "remove_hook_calls"
+	metricRemoveRemoved     = "remove_removed_datasets"
+	metricRemoveLogsGone    = "remove_logs_gone"
+	metricRemoveRefsGone    = "remove_refs_gone"
+	metricRemoveBlocksTotal = "remove_blocks_total"
+	metricRemoveBlocksKept  = "remove_blocks_retained"
+	metricRemoveKept        = "remove_kept_datasets"
+	metricRemoveKeptIntact  = "remove_kept_intact"
+)
+
+var defaultDatasetsPerPusher = 2
+var defaultRemovesPerPusher = 1
+
+var stateRemoveAttempted = sync.State("remove from all remotes attempted")
+
+// errP2PDatasetRemove is the error qri returns after removing a log from a
+// remote addressed by peer ID, when it refuses to ask for the dataset versions
+// to be removed as well
+const errP2PDatasetRemove = "dataset remove requests currently only work over HTTP"
+
+// pushedDataset describes a dataset a pusher pushed, and whether it then
+// asked remotes to remove it
+type pushedDataset struct {
+	Peername string
+	Name     string
+	Path     string
+	Blocks   []string
+	Removed  bool
+}
+
+var pushedDatasetTopic = sync.NewTopic("pushed-dataset", &pushedDataset{})
+
+// RunPlanRemove has pushers push several datasets to every remote, then ask
+// remotes to remove some or all of them:
+//   - pushers push datasetsPerPusher datasets to all remotes
+//   - pushers remove the first removesPerPusher datasets from all remotes
+//   - remotes check the log of each removed dataset is gone, while kept
+//     datasets are untouched
+//
+// at the time of writing qri removes logs over p2p, but only asks HTTP remotes
+// to drop dataset versions. remotes here are addressed by peer ID, so removes
+// fail once the log is gone & remotes keep refs. over p2p qri also removes
+// logs without calling the LogRemoved hook, so neither remove hook fires.
+// the test asserts exactly that: pushers assert each remove fails with qri's
+// HTTP-only error, receivers assert removed logs are gone & no remove hook
+// was called. a qri that removes datasets over p2p fails the run, & this test
+// should then assert the hooks fire instead
+func RunPlanRemove(ctx context.Context, p *plan.Plan) error {
+	pushersPerReceiver := getPushersPerReceiver(p)
+	if pushersPerReceiver >= p.Runenv.TestInstanceCount {
+		return fmt.Errorf("Remove variable specify %d pusher per receiver, but there are only %d instances", pushersPerReceiver, p.Runenv.TestInstanceCount)
+	}
+	if err := p.AssignRoles(
+		plan.Role{Name: rolePusher, Weight: pushersPerReceiver},
+		plan.Role{Name: roleReceiver, Weight: 1},
+	); err != nil {
+		return err
+	}
+	if err := p.SetupNetwork(ctx); err != nil {
+		return err
+	}
+	isReceiver := p.Role() == roleReceiver
+
+	constructor := newRemovePusher
+	if isReceiver {
+		constructor = newReceiver
+	}
+	if err := p.ConstructActor(ctx, constructor); err != nil {
+		return err
+	}
+
+	// Share this node's info w/ all nodes on the network
+	if err := p.ShareInfo(ctx); err != nil {
+		return err
+	}
+
+	executeActions := removePusherActions
+	if isReceiver {
+		executeActions = removeReceiverActions
+	}
+	if err := executeActions(ctx, p); err != nil {
+		p.Runenv.RecordFailure(err)
+	}
+	p.ActorFinished(ctx)
+	return p.Outcome(ctx)
+}
+
+func getDatasetsPerPusher(p *plan.Plan) int {
+	n := p.Runenv.IntParam("datasetsPerPusher")
+	if n < 1 {
+		return defaultDatasetsPerPusher
+	}
+	return n
+}
+
+// getRemovesPerPusher returns the number of datasets each pusher removes,
+// capped at the number of datasets it pushes
+func getRemovesPerPusher(p *plan.Plan) int {
+	n := p.Runenv.IntParam("removesPerPusher")
+	if n < 0 {
+		n = defaultRemovesPerPusher
+	}
+	if max := getDatasetsPerPusher(p); n > max {
+		n = max
+	}
+	return n
+}
+
+func removeDatasetName(i int) string {
+	return fmt.Sprintf("%s_%d", datasetName, i)
+}
+
+func newRemovePusher(ctx context.Context, p *plan.Plan) (*sim.Actor, error) {
+	act, err := sim.NewActor(ctx, p.Runenv, p.Client, p.Seq, lib.OptEventHandler(eventHandler(ctx, p), eventsToHandle...))
+	if err != nil {
+		return nil, err
+	}
+
+	for i := 0; i < getDatasetsPerPusher(p); i++ {
+		if err := act.GenerateDatasetVersion(removeDatasetName(i), getDatasetRows(p)); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := act.Inst.Connect(ctx); err != nil {
+		return nil, err
+	}
+
+	if err := p.ReceiveRemoteInfo(ctx, act, p.Roles.Count(roleReceiver)); err != nil {
+		return nil, err
+	}
+
+	p.Runenv.RecordMessage("I'm a Pusher named %s", act.Peername())
+	p.Runenv.RecordMessage("My qri ID is %s", act.ID())
+	p.Runenv.RecordMessage("My peer ID is %s", act.AddrInfo().ID)
+	return act, nil
+}
+
+// removePusherActions pushes every dataset, then removes the first
+// removesPerPusher of them from each remote. a dataset is published to
+// receivers & the remove state signalled even if pushing or removing fails,
+// so receivers never wait on a pusher that gave up
+func removePusherActions(ctx context.Context, p *plan.Plan) error {
+	var accErr error
+	removes := getRemovesPerPusher(p)
+
+	for i := 0; i < getDatasetsPerPusher(p); i++ {
+		ds, err := pushAndRemove(ctx, p, removeDatasetName(i), i < removes)
+		if err != nil {
+			accErr = plan.AccumulateErrors(accErr, err)
+		}
+		if _, err := p.Client.Publish(ctx, pushedDatasetTopic, ds); err != nil {
+			accErr = plan.AccumulateErrors(accErr, fmt.Errorf("publishing pushed dataset: %w", err))
+		}
+	}
+
+	p.Client.MustSignalEntry(ctx, stateRemoveAttempted)
+	return accErr
+}
+
+// pushAndRemove pushes the dataset called name to every remote, then removes
+// it again if remove is true. The returned description is never nil, but
+// lacks a path & blocks if the dataset can't be resolved locally
+func pushAndRemove(ctx context.Context, p *plan.Plan, name string, remove bool) (*pushedDataset, error) {
+	ds := &pushedDataset{Peername: p.Actor.Peername(), Name: name, Removed: remove}
+	accErr := p.PushToRemotes(ctx, name)
+
+	ref := &dsref.Ref{Username: ds.Peername, Name: name}
+	if _, err := p.Actor.Inst.ResolveReference(ctx, ref, "local"); err != nil {
+		return ds, plan.AccumulateErrors(accErr, fmt.Errorf("resolving %s: %w", ref.Human(), err))
+	}
+	ds.Path = ref.Path
+	blocks, err := p.Actor.DAGNodes(ctx, ref.Path)
+	if err != nil {
+		accErr = plan.AccumulateErrors(accErr, err)
+	}
+	ds.Blocks = blocks
+
+	if remove {
+		if err := removeFromRemotes(ctx, p, name); err != nil {
+			accErr = plan.AccumulateErrors(accErr, err)
+		}
+	}
+	return ds, accErr
+}
+
+// removeFromRemotes asks every remote to remove all versions of a dataset
+func removeFromRemotes(ctx context.Context, p *plan.Plan, name string) error {
+	rm := lib.NewRemoteMethods(p.Actor.Inst)
+	var accErr error
+
+	for remoteName := range *p.Actor.Inst.Config().Remotes {
+		pp := &lib.PushParams{
+			Ref:        fmt.Sprintf("%s/%s", p.Actor.Peername(), name),
+			RemoteName: remoteName,
+			All:        true,
+		}
+		start := time.Now()
+		err := rm.Remove(pp, &dsref.Ref{})
+		p.RecordPoint(metricRemoveDuration, float64(time.Since(start).Milliseconds()), "remote", remoteName)
+		p.RecordPoint(metricRemoveSuccess, boolPoint(err == nil), "remote", remoteName)
+		p.Assert("remove_http_only", checkP2PRemoveError(err))
+		if err != nil && !strings.Contains(err.Error(), errP2PDatasetRemove) {
+			accErr = plan.AccumulateErrors(accErr, fmt.Errorf("error removing %q from %q: %s", pp.Ref, remoteName, err))
+		}
+	}
+	return accErr
+}
+
+// checkP2PRemoveError errors unless a remove over p2p failed the way qri fails
+// them after removing the log
+func checkP2PRemoveError(err error) error {
+	if err == nil {
+		return fmt.Errorf("expected removing a dataset over p2p to fail with %q, but it succeeded", errP2PDatasetRemove)
+	}
+	if !strings.Contains(err.Error(), errP2PDatasetRemove) {
+		return fmt.Errorf("expected removing a dataset over p2p to fail with %q, got: %s", errP2PDatasetRemove, err)
+	}
+	return nil
+}
+
+// removeReceiverActions waits for pushers to finish removing, then checks the
+// logs of removed datasets are gone & kept datasets are intact
+func removeReceiverActions(ctx context.Context, p *plan.Plan) error {
+	numPushers := p.Roles.Count(rolePusher)
+	<-p.Client.MustBarrier(ctx, stateRemoveAttempted, numPushers).C
+
+	ch := make(chan *pushedDataset)
+	sub, err := p.Client.Subscribe(ctx, pushedDatasetTopic, ch)
+	if err != nil {
+		return fmt.Errorf("pushed dataset subscription failure: %w", err)
+	}
+	expect := numPushers * getDatasetsPerPusher(p)
+	pushed := make([]*pushedDataset, 0, expect)
+	for len(pushed) < expect {
+		select {
+		case ds := <-ch:
+			pushed = append(pushed, ds)
+		case err := <-sub.Done():
+			return err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	removedDatasets, removedLogs := p.Actor.Hooks().Removed()
+	p.Runenv.RecordMessage("remove hooks fired for %d datasets & %d logs", len(removedDatasets), len(removedLogs))
+	p.RecordPoint(metricRemoveHookCalls, float64(len(removedDatasets)), "hook", sim.HookDatasetRemoved)
+	p.RecordPoint(metricRemoveHookCalls, float64(len(removedLogs)), "hook", sim.HookLogRemoved)
+	p.Assert("remove_hooks_not_called", checkNoRemoveHooks(removedDatasets, removedLogs))
+
+	var accErr error
+	logsGone, refsGone, removed, kept, keptIntact := 0, 0, 0, 0, 0
+	for _, ds := range pushed {
+		logGone, refGone := removeReceiverState(p, dsref.Ref{Username: ds.Peername, Name: ds.Name})
+		retained, err := p.Actor.HasBlocks(ds.Blocks)
+		if err != nil {
+			return err
+		}
+
+		if !ds.Removed {
+			kept++
+			if logGone || refGone {
+				accErr = plan.AccumulateErrors(accErr, fmt.Errorf("kept dataset %s/%s is missing its log or ref", ds.Peername, ds.Name))
+				continue
+			}
+			keptIntact++
+			continue
+		}
+
+		removed++
+		// removed blocks are unpinned, but linger until garbage collection
+		p.RecordPoint(metricRemoveBlocksTotal, float64(len(ds.Blocks)), "pusher", ds.Peername)
+		p.RecordPoint(metricRemoveBlocksKept, float64(retained), "pusher", ds.Peername)
+		if logGone {
+			logsGone++
+		} else {
+			accErr = plan.AccumulateErrors(accErr, fmt.Errorf("removed dataset %s/%s log is still in the logbook", ds.Peername, ds.Name))
+		}
+		// over p2p qri only removes logs, see RunPlanRemove
+		if refGone {
+			refsGone++
+		}
+	}
+
+	p.Runenv.RecordMessage("%d of %d removed datasets are gone from the logbook, %d from the repo. %d of %d kept datasets are intact", logsGone, removed, refsGone, keptIntact, kept)
+	p.RecordPoint(metricRemoveRemoved, float64(removed))
+	p.RecordPoint(metricRemoveLogsGone, float64(logsGone))
+	p.RecordPoint(metricRemoveRefsGone, float64(refsGone))
+	p.RecordPoint(metricRemoveKept, float64(kept))
+	p.RecordPoint(metricRemoveKeptIntact, float64(keptIntact))
+	p.Assert("remove_state", accErr)
+	return nil
+}
+
+// checkNoRemoveHooks errors if a remove hook fired. over p2p qri calls
+// neither, see RunPlanRemove
+func checkNoRemoveHooks(datasets, logs []dsref.Ref) error {
+	if len(datasets) > 0 || len(logs) > 0 {
+		return fmt.Errorf("expected no remove hook calls over p2p, got %d %s & %d %s calls", len(datasets), sim.HookDatasetRemoved, len(logs), sim.HookLogRemoved)
+	}
+	return nil
+}
+
+// removeReceiverState reports whether a dataset's log is gone from the
+// actor's logbook & its ref is gone from the actor's repo
+func removeReceiverState(p *plan.Plan, ref dsref.Ref) (logGone, refGone bool) {
+	if _, err := p.Actor.Inst.Repo().Logbook().RefToInitID(ref); err != nil {
+		logGone = true
+	}
+	if _, err := p.Actor.Inst.Repo().GetRef(reporef.RefFromDsref(ref)); err != nil {
+		refGone = true
+	}
+	return logGone, refGone
+}
@@ -0,0 +1,272 @@
+package results
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Stats lists the Distribution statistics thresholds can be set on
+var Stats = []string{"count", "min", "mean", "p50", "p90", "p99", "max"}
+
+// Stat returns the named statistic of d
+func (d Distribution) Stat(name string) (float64, error) {
+	switch name {
+	case "count":
+		return float64(d.Count), nil
+	case "min":
+		return d.Min, nil
+	case "mean":
+		return d.Mean, nil
+	case "p50":
+		return d.P50, nil
+	case "p90":
+		return d.P90, nil
+	case "p99":
+		return d.P99, nil
+	case "max":
+		return d.Max, nil
+	}
+	return 0, fmt.Errorf("unknown statistic %q, must be one of %v", name, Stats)
+}
+
+// Threshold limits how far a statistic of a metric may move between two runs
+type Threshold struct {
+	Metric string `json:"metric"`
+	// Role limits the threshold to the metric as recorded by one role. Empty
+	// matches every role
+	Role string `json:"role,omitempty"`
+	// Tags limits the threshold to metrics with every one of these tags.
+	// each matching set of tags is checked separately
+	Tags map[string]string `json:"tags,omitempty"`
+	Stat string            `json:"stat"`
+	// Percent is the largest allowed change, relative to the first run. A
+	// positive percent limits increases, a negative percent limits decreases.
+	// the sign of zero counts, so -0 means the statistic must not decrease
+	Percent float64 `json:"percent"`
+}
+
+// limitsDecrease reports whether t limits decreases rather than increases
+func (t Threshold) limitsDecrease() bool {
+	return math.Signbit(t.Percent)
+}
+
+// ParseThreshold parses a threshold in the form
+// "metric[,key=value...][@role]:stat:±percent", eg.
+// "push_duration_ms@pusher:p90:+10%" fails when pushers' p90 push time grows
+// by more than 10%, "push_success:mean:-5%" fails when the push success rate
+// drops by more than 5%, & "bandwidth_protocol_bytes,family=bitswap,direction=in:max:+20%"
+// limits only inbound bitswap traffic
+func ParseThreshold(s string) (Threshold, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 3 {
+		return Threshold{}, fmt.Errorf("invalid threshold %q, expected metric[,key=value...][@role]:stat:±percent", s)
+	}
+
+	t := Threshold{Stat: parts[1]}
+	metric := parts[0]
+	if i := strings.Index(metric, "@"); i >= 0 {
+		metric, t.Role = metric[:i], metric[i+1:]
+	}
+	selectors := strings.Split(metric, ",")
+	t.Metric = selectors[0]
+	if t.Metric == "" {
+		return Threshold{}, fmt.Errorf("invalid threshold %q, metric name is required", s)
+	}
+	for _, sel := range selectors[1:] {
+		kv := strings.SplitN(sel, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return Threshold{}, fmt.Errorf("invalid threshold %q, tags must be key=value", s)
+		}
+		if t.Tags == nil {
+			t.Tags = map[string]string{}
+		}
+		t.Tags[kv[0]] = kv[1]
+	}
+	if _, err := (Distribution{}).Stat(t.Stat); err != nil {
+		return Threshold{}, fmt.Errorf("invalid threshold %q: %w", s, err)
+	}
+
+	pct, err := strconv.ParseFloat(strings.TrimSuffix(parts[2], "%"), 64)
+	if err != nil {
+		return Threshold{}, fmt.Errorf("invalid threshold %q, percent must be a number: %w", s, err)
+	}
+	t.Percent = pct
+	return t, nil
+}
+
+// String formats t the way ParseThreshold reads it
+func (t Threshold) String() string {
+	metric := metricLabel(t.Metric, t.Tags)
+	if t.Role != "" {
+		metric += "@" + t.Role
+	}
+	return fmt.Sprintf("%s:%s:%+g%%", metric, t.Stat, t.Percent)
+}
+
+// Comparison lines up the metrics of two runs
+type Comparison struct {
+	Before     string         `json:"before"`
+	After      string         `json:"after"`
+	Metrics    []*MetricDelta `json:"metrics"`
+	Violations []*Violation   `json:"violations,omitempty"`
+}
+
+// MetricDelta is a metric as recorded by one role with one set of tags in
+// both runs. A metric missing from a run has a nil distribution
+type MetricDelta struct {
+	Name   string            `json:"name"`
+	Role   string            `json:"role"`
+	Tags   map[string]string `json:"tags,omitempty"`
+	Before *Distribution     `json:"before"`
+	After  *Distribution     `json:"after"`
+}
+
+// Change returns the relative change of a statistic in percent. ok is false
+// if the metric is missing from either run, or the statistic was zero in the
+// first run
+func (m *MetricDelta) Change(stat string) (pct float64, ok bool) {
+	if m.Before == nil || m.After == nil {
+		return 0, false
+	}
+	before, err := m.Before.Stat(stat)
+	if err != nil {
+		return 0, false
+	}
+	after, _ := m.After.Stat(stat)
+	if before == 0 {
+		return 0, after == 0
+	}
+	return (after - before) / before * 100, true
+}
+
+// Violation is a threshold crossed by a metric
+type Violation struct {
+	Threshold Threshold `json:"threshold"`
+	Role      string    `json:"role"`
+	Before    float64   `json:"before"`
+	After     float64   `json:"after"`
+	// Message describes the violation
+	Message string `json:"message"`
+}
+
+// Compare lines up the metrics of two run summaries by name, role & tags, checking
+// each threshold against every metric it matches. A threshold that matches no
+// metric present in both runs is a violation, so a renamed metric can't
+// silently pass
+func Compare(before, after *Summary, thresholds []Threshold) *Comparison {
+	c := &Comparison{Before: before.Run, After: after.Run}
+
+	index := map[metricKey]*MetricDelta{}
+	deltaFor := func(m *MetricSummary) *MetricDelta {
+		key := metricKey{name: m.Name, role: m.Role, tags: formatTags(m.Tags)}
+		if d, ok := index[key]; ok {
+			return d
+		}
+		d := &MetricDelta{Name: m.Name, Role: m.Role, Tags: m.Tags}
+		index[key] = d
+		c.Metrics = append(c.Metrics, d)
+		return d
+	}
+	for _, m := range before.Metrics {
+		dist := m.Distribution
+		deltaFor(m).Before = &dist
+	}
+	for _, m := range after.Metrics {
+		dist := m.Distribution
+		deltaFor(m).After = &dist
+	}
+	sortDeltas(c.Metrics)
+
+	for _, t := range thresholds {
+		matched := false
+		for _, m := range c.Metrics {
+			if !t.matches(m) || m.Before == nil || m.After == nil {
+				continue
+			}
+			matched = true
+			if v := checkThreshold(t, m); v != nil {
+				c.Violations = append(c.Violations, v)
+			}
+		}
+		if !matched {
+			c.Violations = append(c.Violations, &Violation{
+				Threshold: t,
+				Role:      t.Role,
+				Message:   fmt.Sprintf("%s: metric not recorded in both runs", t),
+			})
+		}
+	}
+	return c
+}
+
+// matches reports whether t applies to m
+func (t Threshold) matches(m *MetricDelta) bool {
+	if m.Name != t.Metric || (t.Role != "" && m.Role != t.Role) {
+		return false
+	}
+	for k, v := range t.Tags {
+		if m.Tags[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// checkThreshold returns a violation if m's change crosses t
+func checkThreshold(t Threshold, m *MetricDelta) *Violation {
+	before, _ := m.Before.Stat(t.Stat)
+	after, _ := m.After.Stat(t.Stat)
+
+	crossed := false
+	if pct, ok := m.Change(t.Stat); ok {
+		crossed = (!t.limitsDecrease() && pct > t.Percent) || (t.limitsDecrease() && pct < t.Percent)
+	} else {
+		// a statistic that was zero can only move by an infinite percentage
+		crossed = (!t.limitsDecrease() && after > before) || (t.limitsDecrease() && after < before)
+	}
+	if !crossed {
+		return nil
+	}
+	return &Violation{
+		Threshold: t,
+		Role:      m.Role,
+		Before:    before,
+		After:     after,
+		Message:   fmt.Sprintf("%s %s of %s moved from %g to %g (%s), crossing %+g%%", m.Role, t.Stat, metricLabel(m.Name, m.Tags), before, after, formatChange(m, t.Stat), t.Percent),
+	}
+}
+
+func sortDeltas(ds []*MetricDelta) {
+	sort.Slice(ds, func(i, j int) bool {
+		if ds[i].Name != ds[j].Name {
+			return ds[i].Name < ds[j].Name
+		}
+		if ds[i].Role != ds[j].Role {
+			return ds[i].Role < ds[j].Role
+		}
+		return formatTags(ds[i].Tags) < formatTags(ds[j].Tags)
+	})
+}
+
+// metricLabel formats a metric name with its tags for display
+func metricLabel(name string, tags map[string]string) string {
+	if len(tags) == 0 {
+		return name
+	}
+	return name + "," + formatTags(tags)
+}
+
+// formatChange formats the relative change of a statistic for display
+func formatChange(m *MetricDelta, stat string) string {
+	if m.Before == nil || m.After == nil {
+		return "-"
+	}
+	pct, ok := m.Change(stat)
+	if !ok {
+		return "inf"
+	}
+	return fmt.Sprintf("%+.1f%%", pct)
+}
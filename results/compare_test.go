@@ -0,0 +1,216 @@
+package results
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestParseThreshold(t *testing.T) {
+	cases := []struct {
+		in     string
+		expect Threshold
+	}{
+		{"push_duration_ms:p90:+10%", Threshold{Metric: "push_duration_ms", Stat: "p90", Percent: 10}},
+		{"push_duration_ms:p90:10", Threshold{Metric: "push_duration_ms", Stat: "p90", Percent: 10}},
+		{"push_success:mean:-5%", Threshold{Metric: "push_success", Stat: "mean", Percent: -5}},
+		{"push_duration_ms@pusher:max:+1.5%", Threshold{Metric: "push_duration_ms", Role: "pusher", Stat: "max", Percent: 1.5}},
+		{"bandwidth_protocol_bytes,family=bitswap,direction=in:max:+20%", Threshold{
+			Metric:  "bandwidth_protocol_bytes",
+			Tags:    map[string]string{"family": "bitswap", "direction": "in"},
+			Stat:    "max",
+			Percent: 20,
+		}},
+		{"bandwidth_total_bytes,phase=setup@receiver:mean:+0%", Threshold{
+			Metric: "bandwidth_total_bytes",
+			Role:   "receiver",
+			Tags:   map[string]string{"phase": "setup"},
+			Stat:   "mean",
+		}},
+		// tag values may hold "="
+		{"m,expr=a=b:count:+0%", Threshold{Metric: "m", Tags: map[string]string{"expr": "a=b"}, Stat: "count"}},
+	}
+
+	for _, c := range cases {
+		got, err := ParseThreshold(c.in)
+		if err != nil {
+			t.Errorf("%q unexpected error: %s", c.in, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, c.expect) {
+			t.Errorf("%q mismatch. expected: %+v, got: %+v", c.in, c.expect, got)
+		}
+		// thresholds format the way they're parsed
+		again, err := ParseThreshold(got.String())
+		if err != nil {
+			t.Errorf("%q reparsing %q: %s", c.in, got.String(), err)
+		} else if !reflect.DeepEqual(again, got) {
+			t.Errorf("%q roundtrip mismatch. expected: %+v, got: %+v", c.in, got, again)
+		}
+	}
+
+	bad := []string{
+		"",
+		"push_duration_ms",
+		"push_duration_ms:p90",
+		"push_duration_ms:p90:+10%:extra",
+		":p90:+10%",
+		"@pusher:p90:+10%",
+		",family=bitswap:max:+10%",
+		"bandwidth_protocol_bytes,family:max:+10%",
+		"bandwidth_protocol_bytes,=bitswap:max:+10%",
+		"push_duration_ms:p95:+10%",
+		"push_duration_ms:p90:ten%",
+	}
+	for _, s := range bad {
+		if _, err := ParseThreshold(s); err == nil {
+			t.Errorf("expected %q to fail to parse", s)
+		}
+	}
+}
+
+func TestParseThresholdNegativeZero(t *testing.T) {
+	neg, err := ParseThreshold("push_success:mean:-0%")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !math.Signbit(neg.Percent) || !neg.limitsDecrease() {
+		t.Errorf("expected -0%% to limit decreases, got percent: %v", neg.Percent)
+	}
+	if s := neg.String(); s != "push_success:mean:-0%" {
+		t.Errorf("string mismatch. expected: %q, got: %q", "push_success:mean:-0%", s)
+	}
+
+	pos, err := ParseThreshold("push_success:mean:+0%")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pos.limitsDecrease() {
+		t.Error("expected +0% to limit increases")
+	}
+}
+
+// summaryOf builds a summary holding a single value for each metric
+func summaryOf(run string, metrics ...*MetricSummary) *Summary {
+	return &Summary{Run: run, Metrics: metrics}
+}
+
+func metricOf(name, role string, tags map[string]string, val float64) *MetricSummary {
+	return &MetricSummary{Name: name, Role: role, Tags: tags, Distribution: NewDistribution([]float64{val})}
+}
+
+func TestCompareThresholds(t *testing.T) {
+	bitswapIn := map[string]string{"family": "bitswap", "direction": "in"}
+	bitswapOut := map[string]string{"family": "bitswap", "direction": "out"}
+	before := summaryOf("before",
+		metricOf("push_duration_ms", "pusher", nil, 100),
+		metricOf("push_duration_ms", "receiver", nil, 100),
+		metricOf("push_success", "pusher", nil, 1),
+		metricOf("errors", "pusher", nil, 0),
+		metricOf("retries", "pusher", nil, 0),
+		metricOf("bandwidth_protocol_bytes", "pusher", bitswapIn, 1000),
+		metricOf("bandwidth_protocol_bytes", "pusher", bitswapOut, 1000),
+		metricOf("removed_metric", "pusher", nil, 1),
+	)
+	after := summaryOf("after",
+		metricOf("push_duration_ms", "pusher", nil, 120),
+		metricOf("push_duration_ms", "receiver", nil, 105),
+		metricOf("push_success", "pusher", nil, 0.9),
+		metricOf("errors", "pusher", nil, 3),
+		metricOf("retries", "pusher", nil, 0),
+		metricOf("bandwidth_protocol_bytes", "pusher", bitswapIn, 1100),
+		metricOf("bandwidth_protocol_bytes", "pusher", bitswapOut, 2000),
+		metricOf("added_metric", "pusher", nil, 1),
+	)
+
+	cases := []struct {
+		threshold string
+		// violations lists the role of each expected violation
+		violations []string
+	}{
+		// increases
+		{"push_duration_ms:mean:+10%", []string{"pusher"}},
+		{"push_duration_ms:mean:+25%", nil},
+		{"push_duration_ms@receiver:mean:+10%", nil},
+		{"push_duration_ms@receiver:mean:+4%", []string{"receiver"}},
+		{"push_duration_ms:mean:+0%", []string{"pusher", "receiver"}},
+		// a limit on increases ignores decreases, & the other way round
+		{"push_success:mean:+0%", nil},
+		{"push_duration_ms:mean:-10%", nil},
+		// decreases
+		{"push_success:mean:-5%", []string{"pusher"}},
+		{"push_success:mean:-15%", nil},
+		{"push_success:mean:-0%", []string{"pusher"}},
+		// a before value of 0 crosses any limit in the direction it moved
+		{"errors:max:+1000%", []string{"pusher"}},
+		{"errors:max:-0%", nil},
+		{"retries:max:+0%", nil},
+		{"retries:max:-0%", nil},
+		// tag selectors check each matching set of tags separately
+		{"bandwidth_protocol_bytes,family=bitswap,direction=in:max:+20%", nil},
+		{"bandwidth_protocol_bytes,family=bitswap:max:+20%", []string{"pusher"}},
+		{"bandwidth_protocol_bytes,family=bitswap:max:+5%", []string{"pusher", "pusher"}},
+		// thresholds that match nothing in both runs are violations
+		{"no_such_metric:mean:+10%", []string{""}},
+		{"push_duration_ms@no_such_role:mean:+10%", []string{"no_such_role"}},
+		{"bandwidth_protocol_bytes,family=identify:max:+10%", []string{""}},
+		{"removed_metric:mean:+10%", []string{""}},
+		{"added_metric:mean:+10%", []string{""}},
+	}
+
+	for _, c := range cases {
+		th, err := ParseThreshold(c.threshold)
+		if err != nil {
+			t.Fatalf("%q: %s", c.threshold, err)
+		}
+		cmp := Compare(before, after, []Threshold{th})
+		roles := []string{}
+		for _, v := range cmp.Violations {
+			roles = append(roles, v.Role)
+		}
+		expect := c.violations
+		if expect == nil {
+			expect = []string{}
+		}
+		if !reflect.DeepEqual(roles, expect) {
+			t.Errorf("%q violations mismatch. expected roles: %v, got: %v", c.threshold, expect, roles)
+			for _, v := range cmp.Violations {
+				t.Logf("  %s", v.Message)
+			}
+		}
+	}
+}
+
+func TestCompareMetrics(t *testing.T) {
+	before := summaryOf("before",
+		metricOf("b", "pusher", nil, 1),
+		metricOf("a", "pusher", map[string]string{"phase": "setup"}, 1),
+	)
+	after := summaryOf("after",
+		metricOf("a", "pusher", map[string]string{"phase": "setup"}, 2),
+		metricOf("a", "pusher", map[string]string{"phase": "actions"}, 2),
+	)
+	cmp := Compare(before, after, nil)
+	if cmp.Before != "before" || cmp.After != "after" {
+		t.Errorf("run mismatch. expected: before after, got: %s %s", cmp.Before, cmp.After)
+	}
+
+	labels := []string{}
+	for _, m := range cmp.Metrics {
+		labels = append(labels, metricLabel(m.Name, m.Tags))
+	}
+	expect := []string{"a,phase=actions", "a,phase=setup", "b"}
+	if !reflect.DeepEqual(labels, expect) {
+		t.Fatalf("metrics mismatch. expected: %v, got: %v", expect, labels)
+	}
+
+	if m := cmp.Metrics[0]; m.Before != nil || m.After == nil {
+		t.Errorf("expected a metric only in the second run to have no before distribution")
+	}
+	if pct, ok := cmp.Metrics[1].Change("mean"); !ok || pct != 100 {
+		t.Errorf("change mismatch. expected: 100, got: %v (ok: %t)", pct, ok)
+	}
+	if _, ok := cmp.Metrics[2].Change("mean"); ok {
+		t.Error("expected a metric missing from a run to have no change")
+	}
+}
@@ -0,0 +1,318 @@
+// Package results reads the outputs testground writes for a run of this plan
+// & summarizes them
+package results
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/testground/sdk-go/runtime"
+)
+
+const (
+	// runOutFile is the file each instance logs run events to
+	runOutFile = "run.out"
+	// resultsOutFile is the file each instance records metrics to
+	resultsOutFile = "results.out"
+	// syncEventsFile is the file each instance records sync events to. it
+	// mirrors plan.SyncEventsAsset
+	syncEventsFile = "sync_events.jsonl"
+	// maxLineSize bounds the length of a single output line
+	maxLineSize = 4 * 1024 * 1024
+)
+
+// Run is every instance output of a test run
+type Run struct {
+	// Path is the outputs directory the run was read from
+	Path string
+	Plan string
+	Case string
+	// ID is the testground run ID. Pooled runs have a comma-separated list
+	ID        string
+	Instances []*Instance
+}
+
+// Instance holds the parsed outputs of a single plan instance
+type Instance struct {
+	// Path is the instance outputs directory, relative to the run's Path
+	Path   string
+	Group  string
+	Params map[string]string
+	Start  time.Time
+	End    time.Time
+	// Outcome is the worst outcome the instance finished with. plans record
+	// non-fatal failures mid-run, so a failed or crashed finish event isn't
+	// undone by a later ok
+	Outcome runtime.EventOutcome
+	// Errors are the error messages of every finish event, in order
+	Errors []string
+	// Messages are the instance's RecordMessage lines, in order
+	Messages []Message
+	Metrics  []Metric
+	// SyncEvents are the signal entries & barriers the instance recorded
+	SyncEvents []SyncEvent
+}
+
+// Role is the instance's role, read from the "role" tag of its metrics. An
+// instance that recorded no tagged metrics has no role
+func (in *Instance) Role() string {
+	for _, m := range in.Metrics {
+		if r := m.Tags["role"]; r != "" {
+			return r
+		}
+	}
+	return ""
+}
+
+// Duration is the time between the instance's start & finish events
+func (in *Instance) Duration() time.Duration {
+	if in.Start.IsZero() || in.End.IsZero() {
+		return 0
+	}
+	return in.End.Sub(in.Start)
+}
+
+// Message is a single message recorded by an instance
+type Message struct {
+	Time time.Time
+	Text string
+}
+
+// Metric is a single recorded metric point, with its name split into the
+// metric name & tags plan.MetricName encodes
+type Metric struct {
+	Time  time.Time
+	Name  string
+	Tags  map[string]string
+	Value float64
+}
+
+// ParseMetricName splits a "name,key=value" metric name into its name & tags
+func ParseMetricName(s string) (name string, tags map[string]string) {
+	parts := strings.Split(s, ",")
+	tags = map[string]string{}
+	for _, p := range parts[1:] {
+		kv := strings.SplitN(p, "=", 2)
+		if len(kv) == 2 {
+			tags[kv[0]] = kv[1]
+		}
+	}
+	return parts[0], tags
+}
+
+// ReadRun reads every instance output below dir. Instances are directories
+// holding a run.out file, so both the local runner's layout & the archives
+// `testground collect` produces can be read. The instances of every run below
+// dir are pooled, so repeated runs of a test case can be summarized together
+func ReadRun(dir string) (*Run, error) {
+	run := &Run{Path: dir}
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || info.Name() != runOutFile {
+			return nil
+		}
+
+		instDir := filepath.Dir(path)
+		rel, err := filepath.Rel(dir, instDir)
+		if err != nil {
+			return err
+		}
+		inst := &Instance{Path: rel}
+		if err := readRunOut(path, run, inst); err != nil {
+			return fmt.Errorf("reading %s: %w", path, err)
+		}
+		if err := readResultsOut(filepath.Join(instDir, resultsOutFile), inst); err != nil {
+			return fmt.Errorf("reading %s: %w", filepath.Join(instDir, resultsOutFile), err)
+		}
+		if err := readSyncEvents(filepath.Join(instDir, syncEventsFile), inst); err != nil {
+			return fmt.Errorf("reading %s: %w", filepath.Join(instDir, syncEventsFile), err)
+		}
+		run.Instances = append(run.Instances, inst)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(run.Instances) == 0 {
+		return nil, fmt.Errorf("no %s files found in %s", runOutFile, dir)
+	}
+
+	sort.Slice(run.Instances, func(i, j int) bool {
+		return instanceLess(run.Instances[i].Path, run.Instances[j].Path)
+	})
+	return run, nil
+}
+
+// addID adds a run ID to the run's list of IDs
+func (r *Run) addID(id string) {
+	for _, existing := range strings.Split(r.ID, ",") {
+		if existing == id {
+			return
+		}
+	}
+	if r.ID != "" {
+		r.ID += ","
+	}
+	r.ID += id
+}
+
+// instanceLess orders instance paths element by element, comparing the
+// numbered directories testground uses numerically
+func instanceLess(a, b string) bool {
+	as := strings.Split(filepath.ToSlash(a), "/")
+	bs := strings.Split(filepath.ToSlash(b), "/")
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		if as[i] == bs[i] {
+			continue
+		}
+		an, aErr := strconv.Atoi(as[i])
+		bn, bErr := strconv.Atoi(bs[i])
+		if aErr == nil && bErr == nil && an != bn {
+			return an < bn
+		}
+		return as[i] < bs[i]
+	}
+	return len(as) < len(bs)
+}
+
+// runOutLine is a single line of run.out
+type runOutLine struct {
+	TS      int64  `json:"ts"`
+	GroupID string `json:"group_id"`
+	Event   struct {
+		Type    runtime.EventType    `json:"type"`
+		Outcome runtime.EventOutcome `json:"outcome"`
+		Error   string               `json:"error"`
+		Message string               `json:"message"`
+		Runenv  *struct {
+			Plan   string            `json:"plan"`
+			Case   string            `json:"case"`
+			Run    string            `json:"run"`
+			Params map[string]string `json:"params"`
+		} `json:"runenv"`
+	} `json:"event"`
+}
+
+func readRunOut(path string, run *Run, inst *Instance) error {
+	return eachLine(path, func(data []byte) error {
+		line := runOutLine{}
+		if err := json.Unmarshal(data, &line); err != nil {
+			// run.out may hold lines written by other loggers. skip them
+			return nil
+		}
+		ts := time.Unix(0, line.TS)
+		if line.GroupID != "" {
+			inst.Group = line.GroupID
+		}
+
+		switch line.Event.Type {
+		case runtime.EventTypeStart:
+			inst.Start = ts
+			if re := line.Event.Runenv; re != nil {
+				inst.Params = re.Params
+				if run.Plan == "" {
+					run.Plan, run.Case = re.Plan, re.Case
+				}
+				run.addID(re.Run)
+			}
+		case runtime.EventTypeMessage:
+			inst.Messages = append(inst.Messages, Message{Time: ts, Text: line.Event.Message})
+		case runtime.EventTypeFinish:
+			inst.End = ts
+			if outcomeRank(line.Event.Outcome) >= outcomeRank(inst.Outcome) {
+				inst.Outcome = line.Event.Outcome
+			}
+			if line.Event.Error != "" {
+				inst.Errors = append(inst.Errors, line.Event.Error)
+			}
+		}
+		return nil
+	})
+}
+
+// outcomeRank orders finish outcomes from best to worst
+func outcomeRank(o runtime.EventOutcome) int {
+	switch o {
+	case runtime.EventOutcomeOK:
+		return 1
+	case runtime.EventOutcomeFailed:
+		return 2
+	case runtime.EventOutcomeCrashed:
+		return 3
+	}
+	return 0
+}
+
+func readResultsOut(path string, inst *Instance) error {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		// instances that record no metrics may not write results.out
+		return nil
+	}
+	return eachLine(path, func(data []byte) error {
+		m := runtime.Metric{}
+		if err := json.Unmarshal(data, &m); err != nil {
+			return err
+		}
+		if m.Type != runtime.MetricPoint {
+			return nil
+		}
+		value, ok := m.Measures["value"].(float64)
+		if !ok {
+			return nil
+		}
+		name, tags := ParseMetricName(m.Name)
+		inst.Metrics = append(inst.Metrics, Metric{
+			Time:  time.Unix(0, m.Timestamp),
+			Name:  name,
+			Tags:  tags,
+			Value: value,
+		})
+		return nil
+	})
+}
+
+func readSyncEvents(path string, inst *Instance) error {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		// runs from before sync events were recorded have no events file
+		return nil
+	}
+	return eachLine(path, func(data []byte) error {
+		evt := SyncEvent{}
+		if err := json.Unmarshal(data, &evt); err != nil {
+			// an instance killed mid-write leaves a partial last line
+			return nil
+		}
+		inst.SyncEvents = append(inst.SyncEvents, evt)
+		return nil
+	})
+}
+
+// eachLine calls fn with every non-empty line of the file at path
+func eachLine(path string, fn func(data []byte) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 0, 64*1024), maxLineSize)
+	for sc.Scan() {
+		if len(sc.Bytes()) == 0 {
+			continue
+		}
+		if err := fn(sc.Bytes()); err != nil {
+			return err
+		}
+	}
+	return sc.Err()
+}
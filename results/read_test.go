@@ -0,0 +1,187 @@
+package results
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/testground/sdk-go/runtime"
+)
+
+func TestParseMetricName(t *testing.T) {
+	cases := []struct {
+		in   string
+		name string
+		tags map[string]string
+	}{
+		{"push_duration_ms", "push_duration_ms", map[string]string{}},
+		{"push_duration_ms,remote=ann,role=pusher", "push_duration_ms", map[string]string{"remote": "ann", "role": "pusher"}},
+		{"bandwidth_total_bytes,phase=setup,direction=in", "bandwidth_total_bytes", map[string]string{"phase": "setup", "direction": "in"}},
+		// values keep any "=" after the first
+		{"m,expr=a=b", "m", map[string]string{"expr": "a=b"}},
+		// parts without a "=" aren't tags
+		{"m,bare,role=remote", "m", map[string]string{"role": "remote"}},
+	}
+
+	for _, c := range cases {
+		name, tags := ParseMetricName(c.in)
+		if name != c.name {
+			t.Errorf("%q name mismatch. expected: %q, got: %q", c.in, c.name, name)
+		}
+		if !reflect.DeepEqual(tags, c.tags) {
+			t.Errorf("%q tags mismatch. expected: %v, got: %v", c.in, c.tags, tags)
+		}
+	}
+}
+
+func TestInstanceLess(t *testing.T) {
+	cases := []struct {
+		in     []string
+		expect []string
+	}{
+		{[]string{"single/10", "single/2", "single/0", "single/1"}, []string{"single/0", "single/1", "single/2", "single/10"}},
+		// numbered directories deeper in the path sort numerically too
+		{[]string{"run/single/10/x", "run/single/9/x"}, []string{"run/single/9/x", "run/single/10/x"}},
+		// non-numeric elements sort as strings, before comparing later numbers
+		{[]string{"b/1", "a/20", "a/3"}, []string{"a/3", "a/20", "b/1"}},
+		// runs with different length IDs sort as strings, not by length
+		{[]string{"zz/single/0", "a-longer-run/single/1"}, []string{"a-longer-run/single/1", "zz/single/0"}},
+		{[]string{"single/2", "single"}, []string{"single", "single/2"}},
+	}
+
+	for _, c := range cases {
+		got := append([]string(nil), c.in...)
+		sort.Slice(got, func(i, j int) bool { return instanceLess(got[i], got[j]) })
+		if !reflect.DeepEqual(got, c.expect) {
+			t.Errorf("order of %v mismatch. expected: %v, got: %v", c.in, c.expect, got)
+		}
+	}
+}
+
+func TestReadRunOutOutcome(t *testing.T) {
+	cases := []struct {
+		description string
+		finishes    []string
+		outcome     runtime.EventOutcome
+		errors      []string
+	}{
+		{"no finish", nil, "", nil},
+		{"ok", []string{`"outcome":"ok"`}, runtime.EventOutcomeOK, nil},
+		{"failed stays failed after ok",
+			[]string{`"outcome":"failed","error":"assertion failed"`, `"outcome":"ok"`},
+			runtime.EventOutcomeFailed, []string{"assertion failed"}},
+		{"ok then failed",
+			[]string{`"outcome":"ok"`, `"outcome":"failed","error":"late failure"`},
+			runtime.EventOutcomeFailed, []string{"late failure"}},
+		{"crashed stays crashed after failed",
+			[]string{`"outcome":"crashed","error":"panic"`, `"outcome":"failed","error":"timeout"`},
+			runtime.EventOutcomeCrashed, []string{"panic", "timeout"}},
+		{"failed then crashed",
+			[]string{`"outcome":"failed","error":"timeout"`, `"outcome":"crashed","error":"panic"`},
+			runtime.EventOutcomeCrashed, []string{"timeout", "panic"}},
+	}
+
+	dir, err := ioutil.TempDir("", "results_read_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for i, c := range cases {
+		lines := []string{`{"ts":1,"event":{"type":"start"}}`}
+		for _, f := range c.finishes {
+			lines = append(lines, `{"ts":2,"event":{"type":"finish",`+f+`}}`)
+		}
+		path := filepath.Join(dir, strings.Replace(c.description, " ", "_", -1))
+		if err := ioutil.WriteFile(path, []byte(strings.Join(lines, "\n")), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		inst := &Instance{}
+		if err := readRunOut(path, &Run{}, inst); err != nil {
+			t.Fatalf("case %d %s: %s", i, c.description, err)
+		}
+		if inst.Outcome != c.outcome {
+			t.Errorf("case %d %s outcome mismatch. expected: %q, got: %q", i, c.description, c.outcome, inst.Outcome)
+		}
+		if !reflect.DeepEqual(inst.Errors, c.errors) {
+			t.Errorf("case %d %s errors mismatch. expected: %v, got: %v", i, c.description, c.errors, inst.Errors)
+		}
+	}
+}
+
+func TestReadRun(t *testing.T) {
+	run, err := ReadRun("testdata/run")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if run.Plan != "qri" || run.Case != "push" || run.ID != "r1" {
+		t.Errorf("run mismatch. expected: qri push r1, got: %s %s %s", run.Plan, run.Case, run.ID)
+	}
+
+	paths := []string{}
+	for _, in := range run.Instances {
+		paths = append(paths, in.Path)
+	}
+	expectPaths := []string{"single/0", "single/2", "single/10"}
+	if !reflect.DeepEqual(paths, expectPaths) {
+		t.Fatalf("instance paths mismatch. expected: %v, got: %v", expectPaths, paths)
+	}
+
+	pusher, receiver, unfinished := run.Instances[0], run.Instances[1], run.Instances[2]
+	if pusher.Group != "single" {
+		t.Errorf("group mismatch. expected: single, got: %q", pusher.Group)
+	}
+	if pusher.Params["latency"] != "100" {
+		t.Errorf("params mismatch. expected latency 100, got: %v", pusher.Params)
+	}
+	if pusher.Outcome != runtime.EventOutcomeOK {
+		t.Errorf("pusher outcome mismatch. expected: ok, got: %q", pusher.Outcome)
+	}
+	if d := pusher.Duration(); d != 2*time.Second {
+		t.Errorf("pusher duration mismatch. expected: 2s, got: %s", d)
+	}
+	if len(pusher.Messages) != 1 || pusher.Messages[0].Text != "About to push to remote" {
+		t.Errorf("pusher messages mismatch. got: %v", pusher.Messages)
+	}
+	// only point metrics are read
+	if len(pusher.Metrics) != 2 {
+		t.Fatalf("pusher metrics mismatch. expected: 2, got: %d", len(pusher.Metrics))
+	}
+	if m := pusher.Metrics[0]; m.Name != "push_duration_ms" || m.Tags["remote"] != "ann" || m.Value != 120 {
+		t.Errorf("pusher metric mismatch. got: %+v", m)
+	}
+	if role := pusher.Role(); role != "pusher" {
+		t.Errorf("pusher role mismatch. expected: pusher, got: %q", role)
+	}
+	// the partial last line is skipped
+	if len(pusher.SyncEvents) != 2 {
+		t.Errorf("pusher sync events mismatch. expected: 2, got: %d", len(pusher.SyncEvents))
+	}
+
+	if receiver.Outcome != runtime.EventOutcomeFailed {
+		t.Errorf("receiver outcome mismatch. expected: failed, got: %q", receiver.Outcome)
+	}
+	if len(receiver.Errors) != 1 {
+		t.Errorf("receiver errors mismatch. expected 1 error, got: %v", receiver.Errors)
+	}
+
+	if unfinished.Outcome != "" || unfinished.Duration() != 0 || unfinished.Role() != "" {
+		t.Errorf("expected an instance without a finish event or metrics to have no outcome, duration or role. got: %q %s %q",
+			unfinished.Outcome, unfinished.Duration(), unfinished.Role())
+	}
+
+	empty, err := ioutil.TempDir("", "results_read_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(empty)
+	if _, err := ReadRun(empty); err == nil {
+		t.Error("expected reading a directory with no instance outputs to fail")
+	}
+}
@@ -0,0 +1,375 @@
+package results
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/testground/sdk-go/runtime"
+)
+
+// noRole labels instances & metrics that have no role
+const noRole = "-"
+
+// metric names recorded by package plan. they're repeated here so reading
+// results doesn't link in qri & libp2p
+const (
+	metricPushDuration    = "push_duration_ms"
+	metricPushBytes       = "push_bytes"
+	metricPushBlocks      = "push_blocks"
+	metricPushSuccess     = "push_success"
+	metricPullDuration    = "pull_duration_ms"
+	metricPullBytes       = "pull_bytes"
+	metricPullBlocks      = "pull_blocks"
+	metricPullSuccess     = "pull_success"
+	metricAssertionPassed = "assertion_passed"
+)
+
+// Summary is an overview of a run, combining the outputs of every instance
+type Summary struct {
+	Plan      string `json:"plan"`
+	Case      string `json:"case"`
+	Run       string `json:"run"`
+	Instances int    `json:"instances"`
+	// Outcomes counts instances by finish outcome. Instances that never
+	// finished are counted as "unfinished"
+	Outcomes   map[string]int     `json:"outcomes"`
+	Roles      []*RoleSummary     `json:"roles"`
+	Remotes    []*RemoteSummary   `json:"remotes,omitempty"`
+	Assertions []*AssertionCount  `json:"assertions,omitempty"`
+	Metrics    []*MetricSummary   `json:"metrics"`
+	Failures   []*InstanceFailure `json:"failures,omitempty"`
+	// InstanceSummaries describe each instance in the order they were read
+	InstanceSummaries []*InstanceSummary `json:"instance_summaries"`
+}
+
+// RoleSummary describes the instances of a single role
+type RoleSummary struct {
+	Role      string `json:"role"`
+	Instances int    `json:"instances"`
+	Succeeded int    `json:"succeeded"`
+	Failed    int    `json:"failed"`
+	// Duration is the distribution of instance run times in milliseconds
+	Duration Distribution     `json:"duration_ms"`
+	Push     *TransferSummary `json:"push,omitempty"`
+	Pull     *TransferSummary `json:"pull,omitempty"`
+}
+
+// RemoteSummary describes transfers to & from a single remote
+type RemoteSummary struct {
+	Remote string           `json:"remote"`
+	Push   *TransferSummary `json:"push,omitempty"`
+	Pull   *TransferSummary `json:"pull,omitempty"`
+}
+
+// TransferSummary describes a set of pushes or pulls
+type TransferSummary struct {
+	Attempted int `json:"attempted"`
+	Succeeded int `json:"succeeded"`
+	// Duration is the distribution of transfer times in milliseconds
+	Duration Distribution `json:"duration_ms"`
+	// Bytes & Blocks total the DAG size of each successfully transferred
+	// version, not the bytes sent over the wire
+	Bytes  float64 `json:"bytes"`
+	Blocks float64 `json:"blocks"`
+}
+
+// AssertionCount tallies the outcomes of a named assertion across instances
+type AssertionCount struct {
+	Name   string `json:"name"`
+	Passed int    `json:"passed"`
+	Failed int    `json:"failed"`
+}
+
+// MetricSummary is the distribution of a metric across every instance of a
+// role, for a single set of tags
+type MetricSummary struct {
+	Name string `json:"name"`
+	Role string `json:"role"`
+	// Tags are the metric's tags, less role & the tags in instanceTags
+	Tags         map[string]string `json:"tags,omitempty"`
+	Distribution `json:"distribution"`
+}
+
+// instanceTags name the instance on the other end of a metric. peernames
+// change from run to run, so metrics are summarized across them
+var instanceTags = map[string]bool{"remote": true, "pusher": true, "peer": true}
+
+// summaryTags returns the tags a metric is summarized by
+func summaryTags(tags map[string]string) map[string]string {
+	st := map[string]string{}
+	for k, v := range tags {
+		if k != "role" && !instanceTags[k] {
+			st[k] = v
+		}
+	}
+	return st
+}
+
+// formatTags formats tags as sorted "key=value" pairs, separated by commas
+func formatTags(tags map[string]string) string {
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, len(keys))
+	for i, k := range keys {
+		pairs[i] = fmt.Sprintf("%s=%s", k, tags[k])
+	}
+	return strings.Join(pairs, ",")
+}
+
+// metricKey identifies a metric summary
+type metricKey struct {
+	name, role, tags string
+}
+
+// metricValues collects the values of a metric summary
+type metricValues struct {
+	tags map[string]string
+	vals []float64
+}
+
+// InstanceFailure describes an instance that didn't finish successfully
+type InstanceFailure struct {
+	Instance string   `json:"instance"`
+	Role     string   `json:"role"`
+	Outcome  string   `json:"outcome"`
+	Errors   []string `json:"errors,omitempty"`
+}
+
+// InstanceSummary describes a single instance
+type InstanceSummary struct {
+	Instance   string `json:"instance"`
+	Group      string `json:"group"`
+	Role       string `json:"role"`
+	Outcome    string `json:"outcome"`
+	DurationMS int64  `json:"duration_ms"`
+	Messages   int    `json:"messages"`
+	Metrics    int    `json:"metrics"`
+}
+
+// Distribution summarizes a set of values
+type Distribution struct {
+	Count int     `json:"count"`
+	Min   float64 `json:"min"`
+	Mean  float64 `json:"mean"`
+	P50   float64 `json:"p50"`
+	P90   float64 `json:"p90"`
+	P99   float64 `json:"p99"`
+	Max   float64 `json:"max"`
+}
+
+// NewDistribution summarizes vals
+func NewDistribution(vals []float64) Distribution {
+	if len(vals) == 0 {
+		return Distribution{}
+	}
+	sorted := append([]float64(nil), vals...)
+	sort.Float64s(sorted)
+
+	sum := 0.0
+	for _, v := range sorted {
+		sum += v
+	}
+	return Distribution{
+		Count: len(sorted),
+		Min:   sorted[0],
+		Mean:  sum / float64(len(sorted)),
+		P50:   percentile(sorted, 0.5),
+		P90:   percentile(sorted, 0.9),
+		P99:   percentile(sorted, 0.99),
+		Max:   sorted[len(sorted)-1],
+	}
+}
+
+// percentile returns the nearest-rank percentile p of sorted values
+func percentile(sorted []float64, p float64) float64 {
+	rank := int(math.Ceil(p*float64(len(sorted)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	return sorted[rank]
+}
+
+// transferValues collects the values of a kind of transfer's metrics
+type transferValues struct {
+	durations         []float64
+	attempted, passed int
+	bytes, blocks     float64
+}
+
+func (t *transferValues) add(m Metric, duration, success, bytes, blocks string) {
+	switch m.Name {
+	case duration:
+		t.durations = append(t.durations, m.Value)
+	case success:
+		t.attempted++
+		if m.Value == 1 {
+			t.passed++
+		}
+	case bytes:
+		t.bytes += m.Value
+	case blocks:
+		t.blocks += m.Value
+	}
+}
+
+func (t *transferValues) summary() *TransferSummary {
+	if t == nil || t.attempted == 0 {
+		return nil
+	}
+	return &TransferSummary{
+		Attempted: t.attempted,
+		Succeeded: t.passed,
+		Duration:  NewDistribution(t.durations),
+		Bytes:     t.bytes,
+		Blocks:    t.blocks,
+	}
+}
+
+// transfers collects push & pull metrics
+type transfers struct {
+	push, pull transferValues
+}
+
+func (t *transfers) add(m Metric) {
+	t.push.add(m, metricPushDuration, metricPushSuccess, metricPushBytes, metricPushBlocks)
+	t.pull.add(m, metricPullDuration, metricPullSuccess, metricPullBytes, metricPullBlocks)
+}
+
+// Summarize combines the outputs of every instance in a run
+func Summarize(run *Run) *Summary {
+	s := &Summary{
+		Plan:      run.Plan,
+		Case:      run.Case,
+		Run:       run.ID,
+		Instances: len(run.Instances),
+		Outcomes:  map[string]int{},
+	}
+
+	var (
+		roles      = map[string]*RoleSummary{}
+		durations  = map[string][]float64{}
+		roleXfers  = map[string]*transfers{}
+		remotes    = map[string]*transfers{}
+		assertions = map[string]*AssertionCount{}
+		metrics    = map[metricKey]*metricValues{}
+	)
+
+	for _, in := range run.Instances {
+		role := in.Role()
+		if role == "" {
+			role = noRole
+		}
+		outcome := string(in.Outcome)
+		if outcome == "" {
+			outcome = "unfinished"
+		}
+		s.Outcomes[outcome]++
+
+		rs, ok := roles[role]
+		if !ok {
+			rs = &RoleSummary{Role: role}
+			roles[role] = rs
+			roleXfers[role] = &transfers{}
+		}
+		rs.Instances++
+		if in.Outcome == runtime.EventOutcomeOK {
+			rs.Succeeded++
+		} else {
+			rs.Failed++
+			s.Failures = append(s.Failures, &InstanceFailure{
+				Instance: in.Path,
+				Role:     role,
+				Outcome:  outcome,
+				Errors:   in.Errors,
+			})
+		}
+		if d := in.Duration(); d > 0 {
+			durations[role] = append(durations[role], float64(d.Milliseconds()))
+		}
+
+		s.InstanceSummaries = append(s.InstanceSummaries, &InstanceSummary{
+			Instance:   in.Path,
+			Group:      in.Group,
+			Role:       role,
+			Outcome:    outcome,
+			DurationMS: in.Duration().Milliseconds(),
+			Messages:   len(in.Messages),
+			Metrics:    len(in.Metrics),
+		})
+
+		for _, m := range in.Metrics {
+			tags := summaryTags(m.Tags)
+			key := metricKey{name: m.Name, role: role, tags: formatTags(tags)}
+			if metrics[key] == nil {
+				metrics[key] = &metricValues{tags: tags}
+			}
+			metrics[key].vals = append(metrics[key].vals, m.Value)
+			roleXfers[role].add(m)
+			if remote := m.Tags["remote"]; remote != "" {
+				if remotes[remote] == nil {
+					remotes[remote] = &transfers{}
+				}
+				remotes[remote].add(m)
+			}
+			if m.Name == metricAssertionPassed {
+				name := m.Tags["assertion"]
+				if assertions[name] == nil {
+					assertions[name] = &AssertionCount{Name: name}
+				}
+				if m.Value == 1 {
+					assertions[name].Passed++
+				} else {
+					assertions[name].Failed++
+				}
+			}
+		}
+	}
+
+	for role, rs := range roles {
+		rs.Duration = NewDistribution(durations[role])
+		rs.Push = roleXfers[role].push.summary()
+		rs.Pull = roleXfers[role].pull.summary()
+		s.Roles = append(s.Roles, rs)
+	}
+	sort.Slice(s.Roles, func(i, j int) bool { return s.Roles[i].Role < s.Roles[j].Role })
+
+	for remote, t := range remotes {
+		s.Remotes = append(s.Remotes, &RemoteSummary{
+			Remote: remote,
+			Push:   t.push.summary(),
+			Pull:   t.pull.summary(),
+		})
+	}
+	sort.Slice(s.Remotes, func(i, j int) bool { return s.Remotes[i].Remote < s.Remotes[j].Remote })
+
+	for _, a := range assertions {
+		s.Assertions = append(s.Assertions, a)
+	}
+	sort.Slice(s.Assertions, func(i, j int) bool { return s.Assertions[i].Name < s.Assertions[j].Name })
+
+	for key, mv := range metrics {
+		s.Metrics = append(s.Metrics, &MetricSummary{
+			Name:         key.name,
+			Role:         key.role,
+			Tags:         mv.tags,
+			Distribution: NewDistribution(mv.vals),
+		})
+	}
+	sort.Slice(s.Metrics, func(i, j int) bool {
+		a, b := s.Metrics[i], s.Metrics[j]
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		if a.Role != b.Role {
+			return a.Role < b.Role
+		}
+		return formatTags(a.Tags) < formatTags(b.Tags)
+	})
+
+	return s
+}
@@ -0,0 +1,104 @@
+package results
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNewDistribution(t *testing.T) {
+	cases := []struct {
+		vals   []float64
+		expect Distribution
+	}{
+		{nil, Distribution{}},
+		{[]float64{}, Distribution{}},
+		{[]float64{5}, Distribution{Count: 1, Min: 5, Mean: 5, P50: 5, P90: 5, P99: 5, Max: 5}},
+		{[]float64{3, 1}, Distribution{Count: 2, Min: 1, Mean: 2, P50: 1, P90: 3, P99: 3, Max: 3}},
+		{[]float64{4, 1, 3, 2}, Distribution{Count: 4, Min: 1, Mean: 2.5, P50: 2, P90: 4, P99: 4, Max: 4}},
+	}
+
+	for i, c := range cases {
+		got := NewDistribution(c.vals)
+		if got != c.expect {
+			t.Errorf("case %d %v mismatch. expected: %+v, got: %+v", i, c.vals, c.expect, got)
+		}
+	}
+}
+
+func TestNewDistributionDoesntSortInput(t *testing.T) {
+	vals := []float64{3, 1, 2}
+	NewDistribution(vals)
+	if !reflect.DeepEqual(vals, []float64{3, 1, 2}) {
+		t.Errorf("expected input to be left unsorted, got: %v", vals)
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	cases := []struct {
+		sorted []float64
+		p      float64
+		expect float64
+	}{
+		{[]float64{7}, 0, 7},
+		{[]float64{7}, 0.5, 7},
+		{[]float64{7}, 1, 7},
+		{[]float64{1, 2}, 0, 1},
+		{[]float64{1, 2}, 0.5, 1},
+		{[]float64{1, 2}, 0.51, 2},
+		{[]float64{1, 2}, 1, 2},
+		{[]float64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}, 0.9, 9},
+		{[]float64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}, 0.99, 10},
+	}
+
+	for i, c := range cases {
+		if got := percentile(c.sorted, c.p); got != c.expect {
+			t.Errorf("case %d p%v of %v mismatch. expected: %v, got: %v", i, c.p*100, c.sorted, c.expect, got)
+		}
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	run, err := ReadRun("testdata/run")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := Summarize(run)
+
+	expectOutcomes := map[string]int{"ok": 1, "failed": 1, "unfinished": 1}
+	if !reflect.DeepEqual(s.Outcomes, expectOutcomes) {
+		t.Errorf("outcomes mismatch. expected: %v, got: %v", expectOutcomes, s.Outcomes)
+	}
+
+	roles := []string{}
+	for _, r := range s.Roles {
+		roles = append(roles, r.Role)
+	}
+	if expect := []string{noRole, "pusher", "receiver"}; !reflect.DeepEqual(roles, expect) {
+		t.Errorf("roles mismatch. expected: %v, got: %v", expect, roles)
+	}
+
+	if len(s.Failures) != 2 {
+		t.Fatalf("failures mismatch. expected: 2, got: %d", len(s.Failures))
+	}
+	if f := s.Failures[0]; f.Instance != "single/2" || f.Outcome != "failed" || len(f.Errors) != 1 {
+		t.Errorf("failure mismatch. got: %+v", f)
+	}
+
+	if len(s.Remotes) != 1 || s.Remotes[0].Remote != "ann" || s.Remotes[0].Push == nil {
+		t.Fatalf("expected a push summary for remote ann, got: %+v", s.Remotes)
+	}
+	if push := s.Remotes[0].Push; push.Attempted != 1 || push.Succeeded != 1 || push.Duration.Mean != 120 {
+		t.Errorf("remote push summary mismatch. got: %+v", push)
+	}
+
+	if len(s.Assertions) != 1 || s.Assertions[0].Name != "pushes_received" || s.Assertions[0].Failed != 1 {
+		t.Errorf("assertions mismatch. got: %+v", s.Assertions)
+	}
+
+	// remote is an instance tag, so metrics are summarized across remotes
+	for _, m := range s.Metrics {
+		if _, ok := m.Tags["remote"]; ok {
+			t.Errorf("expected metric %s to be summarized across remotes, got tags: %v", m.Name, m.Tags)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package results
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// WriteText writes a summary as human-readable tables
+func WriteText(w io.Writer, s *Summary) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+
+	fmt.Fprintf(tw, "plan: %s\ncase: %s\nrun: %s\ninstances: %d\n", s.Plan, s.Case, s.Run, s.Instances)
+	outcomes := make([]string, 0, len(s.Outcomes))
+	for o, n := range s.Outcomes {
+		outcomes = append(outcomes, fmt.Sprintf("%s=%d", o, n))
+	}
+	sort.Strings(outcomes)
+	fmt.Fprintf(tw, "outcomes: %s\n", strings.Join(outcomes, " "))
+
+	fmt.Fprintf(tw, "\nROLES\nrole\tinstances\tsucceeded\tfailed\tp50 ms\tp90 ms\tp99 ms\n")
+	for _, r := range s.Roles {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%s\n", r.Role, r.Instances, r.Succeeded, r.Failed, percentiles(r.Duration))
+	}
+
+	fmt.Fprintf(tw, "\nTRANSFERS BY ROLE\n%s\n", transferHeader("role"))
+	for _, r := range s.Roles {
+		writeTransfer(tw, r.Role, "push", r.Push)
+		writeTransfer(tw, r.Role, "pull", r.Pull)
+	}
+
+	if len(s.Remotes) > 0 {
+		fmt.Fprintf(tw, "\nTRANSFERS BY REMOTE\n%s\n", transferHeader("remote"))
+		for _, r := range s.Remotes {
+			writeTransfer(tw, r.Remote, "push", r.Push)
+			writeTransfer(tw, r.Remote, "pull", r.Pull)
+		}
+	}
+
+	if len(s.Assertions) > 0 {
+		fmt.Fprintf(tw, "\nASSERTIONS\nassertion\tpassed\tfailed\n")
+		for _, a := range s.Assertions {
+			fmt.Fprintf(tw, "%s\t%d\t%d\n", a.Name, a.Passed, a.Failed)
+		}
+	}
+
+	fmt.Fprintf(tw, "\nMETRICS\nmetric\trole\tcount\tmin\tmean\tp50\tp90\tp99\tmax\n")
+	for _, m := range s.Metrics {
+		d := m.Distribution
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%g\t%.2f\t%g\t%g\t%g\t%g\n", metricLabel(m.Name, m.Tags), m.Role, d.Count, d.Min, d.Mean, d.P50, d.P90, d.P99, d.Max)
+	}
+
+	fmt.Fprintf(tw, "\nINSTANCES\ninstance\tgroup\trole\toutcome\tduration ms\tmessages\tmetrics\n")
+	for _, in := range s.InstanceSummaries {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%d\t%d\t%d\n", in.Instance, in.Group, in.Role, in.Outcome, in.DurationMS, in.Messages, in.Metrics)
+	}
+
+	if len(s.Failures) > 0 {
+		fmt.Fprintf(tw, "\nFAILURES\n")
+		for _, f := range s.Failures {
+			fmt.Fprintf(tw, "%s (%s) %s: %s\n", f.Instance, f.Role, f.Outcome, strings.Join(f.Errors, "; "))
+		}
+	}
+	return tw.Flush()
+}
+
+// WriteMessages writes every message recorded by each instance of a run
+func WriteMessages(w io.Writer, run *Run) error {
+	for _, in := range run.Instances {
+		role := in.Role()
+		if role == "" {
+			role = noRole
+		}
+		if _, err := fmt.Fprintf(w, "\n== %s (%s) ==\n", in.Path, role); err != nil {
+			return err
+		}
+		for _, m := range in.Messages {
+			if _, err := fmt.Fprintf(w, "%s %s\n", m.Time.Format("15:04:05.000"), m.Text); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func transferHeader(by string) string {
+	return by + "\tkind\tattempted\tsucceeded\tp50 ms\tp90 ms\tp99 ms\tbytes\tblocks"
+}
+
+func writeTransfer(w io.Writer, name, kind string, t *TransferSummary) {
+	if t == nil {
+		return
+	}
+	fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%s\t%g\t%g\n", name, kind, t.Attempted, t.Succeeded, percentiles(t.Duration), t.Bytes, t.Blocks)
+}
+
+func percentiles(d Distribution) string {
+	return fmt.Sprintf("%g\t%g\t%g", d.P50, d.P90, d.P99)
+}
+
+// WriteComparisonText writes a comparison as a human-readable table, followed
+// by any crossed thresholds
+func WriteComparisonText(w io.Writer, c *Comparison) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+
+	fmt.Fprintf(tw, "before: %s\nafter: %s\n", c.Before, c.After)
+	fmt.Fprintf(tw, "\nMETRICS\nmetric\trole\tcount\tmean before\tafter\tchange\tp50 before\tafter\tchange\tp90 before\tafter\tchange\n")
+	for _, m := range c.Metrics {
+		fmt.Fprintf(tw, "%s\t%s\t%s", metricLabel(m.Name, m.Tags), m.Role, statPair(m, "count"))
+		for _, stat := range []string{"mean", "p50", "p90"} {
+			fmt.Fprintf(tw, "\t%s\t%s", statPair(m, stat), formatChange(m, stat))
+		}
+		fmt.Fprintln(tw)
+	}
+
+	if len(c.Violations) > 0 {
+		fmt.Fprintf(tw, "\nTHRESHOLDS CROSSED\n")
+		for _, v := range c.Violations {
+			fmt.Fprintln(tw, v.Message)
+		}
+	}
+	return tw.Flush()
+}
+
+// statPair formats a statistic as recorded in both runs
+func statPair(m *MetricDelta, stat string) string {
+	format := func(d *Distribution) string {
+		if d == nil {
+			return "-"
+		}
+		v, _ := d.Stat(stat)
+		return fmt.Sprintf("%.4g", v)
+	}
+	if stat == "count" {
+		return format(m.Before) + " -> " + format(m.After)
+	}
+	return format(m.Before) + "\t" + format(m.After)
+}
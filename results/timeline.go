@@ -0,0 +1,393 @@
+package results
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"sort"
+	"time"
+)
+
+// SyncEvent is a signal entry, barrier wait or barrier release recorded by an
+// instance. It mirrors plan.SyncEvent
+type SyncEvent struct {
+	Kind    string    `json:"kind"`
+	State   string    `json:"state"`
+	Target  int       `json:"target,omitempty"`
+	Count   int64     `json:"count,omitempty"`
+	Barrier int64     `json:"barrier,omitempty"`
+	Error   string    `json:"error,omitempty"`
+	Seq     int64     `json:"seq"`
+	Time    time.Time `json:"time"`
+}
+
+// sync event kinds, mirroring the plan.SyncEventKind constants
+const (
+	syncEventSignal  = "signal"
+	syncEventWait    = "wait"
+	syncEventRelease = "release"
+)
+
+// Timeline places every instance's sync events on a shared clock
+type Timeline struct {
+	Start time.Time
+	End   time.Time
+	// States lists every sync state in the order it was first seen
+	States []string
+	Lanes  []*Lane
+}
+
+// Lane is the sync history of a single instance
+type Lane struct {
+	Instance string
+	Role     string
+	Seq      int64
+	Outcome  string
+	// End is when the instance finished, or the end of the timeline if it
+	// never did
+	End     time.Time
+	Spans   []*Span
+	Signals []*Signal
+	// Tracks is the number of rows needed to draw overlapping spans
+	Tracks int
+	// Waited is the total time spent waiting on barriers
+	Waited time.Duration
+	// Straggled counts the states this instance was the last to signal
+	Straggled int
+}
+
+// Span is the time an instance spent waiting on a barrier
+type Span struct {
+	State  string
+	Target int
+	Start  time.Time
+	End    time.Time
+	// Released is false for barriers that never fired
+	Released bool
+	Error    string
+	Track    int
+}
+
+// Signal is an instance signalling entry into a state
+type Signal struct {
+	State string
+	Count int64
+	Time  time.Time
+	// Last is true if no other instance signalled the state later
+	Last bool
+}
+
+// NewTimeline builds a timeline from the sync events of every instance in a
+// run. Instances are ordered by sequence number
+func NewTimeline(run *Run) *Timeline {
+	t := &Timeline{}
+	seen := map[string]bool{}
+	observe := func(ts time.Time, state string) {
+		if t.Start.IsZero() || ts.Before(t.Start) {
+			t.Start = ts
+		}
+		if ts.After(t.End) {
+			t.End = ts
+		}
+		if state != "" && !seen[state] {
+			seen[state] = true
+			t.States = append(t.States, state)
+		}
+	}
+
+	for _, in := range run.Instances {
+		if len(in.SyncEvents) == 0 {
+			continue
+		}
+		lane := &Lane{Instance: in.Path, Role: in.Role(), Outcome: string(in.Outcome), End: in.End}
+		if lane.Outcome == "" {
+			lane.Outcome = "unfinished"
+		}
+		if !in.End.IsZero() {
+			observe(in.End, "")
+		}
+
+		waiting := map[int64]*Span{}
+		for _, evt := range in.SyncEvents {
+			observe(evt.Time, evt.State)
+			if evt.Seq != 0 {
+				lane.Seq = evt.Seq
+			}
+			switch evt.Kind {
+			case syncEventSignal:
+				lane.Signals = append(lane.Signals, &Signal{State: evt.State, Count: evt.Count, Time: evt.Time})
+			case syncEventWait:
+				span := &Span{State: evt.State, Target: evt.Target, Start: evt.Time}
+				waiting[evt.Barrier] = span
+				lane.Spans = append(lane.Spans, span)
+			case syncEventRelease:
+				if span, ok := waiting[evt.Barrier]; ok {
+					span.End = evt.Time
+					span.Released = evt.Error == ""
+					span.Error = evt.Error
+					delete(waiting, evt.Barrier)
+				}
+			}
+		}
+		t.Lanes = append(t.Lanes, lane)
+	}
+
+	for _, lane := range t.Lanes {
+		if lane.End.IsZero() {
+			lane.End = t.End
+		}
+		for _, span := range lane.Spans {
+			if span.End.IsZero() {
+				span.End = lane.End
+			}
+			lane.Waited += span.End.Sub(span.Start)
+		}
+		lane.Tracks = assignTracks(lane.Spans)
+	}
+	markStragglers(t.Lanes)
+
+	sort.SliceStable(t.Lanes, func(i, j int) bool { return t.Lanes[i].Seq < t.Lanes[j].Seq })
+	return t
+}
+
+// assignTracks places spans on the fewest rows that keep them from
+// overlapping, returning the number of rows
+func assignTracks(spans []*Span) int {
+	var trackEnds []time.Time
+	for _, span := range spans {
+		placed := false
+		for i, end := range trackEnds {
+			if !span.Start.Before(end) {
+				span.Track = i
+				trackEnds[i] = span.End
+				placed = true
+				break
+			}
+		}
+		if !placed {
+			span.Track = len(trackEnds)
+			trackEnds = append(trackEnds, span.End)
+		}
+	}
+	if len(trackEnds) == 0 {
+		return 1
+	}
+	return len(trackEnds)
+}
+
+// markStragglers flags the last signal of each state across all lanes.
+// States signalled by a single instance have no stragglers
+func markStragglers(lanes []*Lane) {
+	type latest struct {
+		sig     *Signal
+		lane    *Lane
+		signals int
+	}
+	last := map[string]*latest{}
+	for _, lane := range lanes {
+		for _, sig := range lane.Signals {
+			l, ok := last[sig.State]
+			if !ok {
+				last[sig.State] = &latest{sig: sig, lane: lane, signals: 1}
+				continue
+			}
+			l.signals++
+			if sig.Time.After(l.sig.Time) {
+				l.sig, l.lane = sig, lane
+			}
+		}
+	}
+	for _, l := range last {
+		if l.signals > 1 {
+			l.sig.Last = true
+			l.lane.Straggled++
+		}
+	}
+}
+
+// timeline drawing dimensions, in pixels
+const (
+	tlLabelWidth = 300
+	tlChartWidth = 1100
+	tlTrackH     = 14
+	tlLanePad    = 8
+	tlAxisH      = 24
+	tlTicks      = 10
+)
+
+// timelinePalette colors sync states in the order they're first seen
+var timelinePalette = []string{
+	"#4e79a7", "#f28e2b", "#59a14f", "#b07aa1", "#76b7b2",
+	"#edc948", "#9c755f", "#bab0ac", "#ff9da7", "#86bcb6",
+}
+
+type tlRect struct {
+	X, Y, W, H float64
+	Fill       string
+	Stuck      bool
+	Title      string
+}
+
+type tlMark struct {
+	X, Y  float64
+	Fill  string
+	Last  bool
+	Title string
+}
+
+type tlLane struct {
+	Y, H   float64
+	Label  string
+	Detail string
+	Failed bool
+}
+
+type tlTick struct {
+	X     float64
+	Label string
+}
+
+type tlLegend struct {
+	State string
+	Fill  string
+}
+
+type timelineView struct {
+	Title       string
+	Width       float64
+	Height      float64
+	ChartX      float64
+	ChartW      float64
+	Lanes       []tlLane
+	Rects       []tlRect
+	Marks       []tlMark
+	Ticks       []tlTick
+	Legend      []tlLegend
+	Annotations []string
+}
+
+// WriteTimelineHTML writes a self-contained HTML page drawing a swimlane for
+// each instance: a bar for each barrier the instance waited on & a mark for
+// each state it signalled. Barriers that never fired are outlined in red,
+// the last instance to signal each state gets a larger mark
+func WriteTimelineHTML(w io.Writer, run *Run) error {
+	t := NewTimeline(run)
+	if len(t.Lanes) == 0 {
+		return fmt.Errorf("no sync events found in %s", run.Path)
+	}
+	total := t.End.Sub(t.Start)
+	if total <= 0 {
+		total = time.Millisecond
+	}
+	x := func(ts time.Time) float64 {
+		return tlLabelWidth + float64(ts.Sub(t.Start))/float64(total)*tlChartWidth
+	}
+
+	colors := map[string]string{}
+	v := &timelineView{
+		Title:  fmt.Sprintf("%s %s %s", run.Plan, run.Case, run.ID),
+		Width:  tlLabelWidth + tlChartWidth + 20,
+		ChartX: tlLabelWidth,
+		ChartW: tlChartWidth,
+	}
+	for i, state := range t.States {
+		colors[state] = timelinePalette[i%len(timelinePalette)]
+		v.Legend = append(v.Legend, tlLegend{State: state, Fill: colors[state]})
+	}
+	for i := 0; i <= tlTicks; i++ {
+		offset := total * time.Duration(i) / tlTicks
+		v.Ticks = append(v.Ticks, tlTick{
+			X:     tlLabelWidth + float64(i)/tlTicks*tlChartWidth,
+			Label: fmt.Sprintf("%.1fs", offset.Seconds()),
+		})
+	}
+
+	y := float64(tlAxisH)
+	for _, lane := range t.Lanes {
+		h := float64(lane.Tracks*tlTrackH + tlLanePad)
+		role := lane.Role
+		if role == "" {
+			role = noRole
+		}
+		v.Lanes = append(v.Lanes, tlLane{
+			Y:      y,
+			H:      h,
+			Label:  fmt.Sprintf("seq %d %s (%s)", lane.Seq, role, lane.Instance),
+			Detail: fmt.Sprintf("%s, waited %.1fs, last to signal %d", lane.Outcome, lane.Waited.Seconds(), lane.Straggled),
+			Failed: lane.Outcome != "ok",
+		})
+
+		for _, span := range lane.Spans {
+			width := x(span.End) - x(span.Start)
+			if width < 1 {
+				width = 1
+			}
+			status := "released"
+			if !span.Released {
+				status = "never released"
+				if span.Error != "" {
+					status = "failed: " + span.Error
+				}
+			}
+			v.Rects = append(v.Rects, tlRect{
+				X:     x(span.Start),
+				Y:     y + tlLanePad/2 + float64(span.Track*tlTrackH),
+				W:     width,
+				H:     tlTrackH - 3,
+				Fill:  colors[span.State],
+				Stuck: !span.Released,
+				Title: fmt.Sprintf("wait %q for %d: %.3fs, %s", span.State, span.Target, span.End.Sub(span.Start).Seconds(), status),
+			})
+			if !span.Released {
+				v.Annotations = append(v.Annotations, fmt.Sprintf("seq %d (%s) waited on %q for %d: %s", lane.Seq, lane.Instance, span.State, span.Target, status))
+			}
+		}
+		for _, sig := range lane.Signals {
+			v.Marks = append(v.Marks, tlMark{
+				X:     x(sig.Time),
+				Y:     y + h/2,
+				Fill:  colors[sig.State],
+				Last:  sig.Last,
+				Title: fmt.Sprintf("signal %q, entry %d at %.3fs", sig.State, sig.Count, sig.Time.Sub(t.Start).Seconds()),
+			})
+		}
+		y += h
+	}
+	v.Height = y + 4
+
+	return timelineTmpl.Execute(w, v)
+}
+
+var timelineTmpl = template.Must(template.New("timeline").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: sans-serif; font-size: 12px; margin: 16px; }
+svg text { font-size: 11px; }
+.legend span { display: inline-block; margin-right: 12px; }
+.legend i { display: inline-block; width: 10px; height: 10px; margin-right: 4px; }
+</style>
+</head>
+<body>
+<h3>{{.Title}}</h3>
+<div class="legend">{{range .Legend}}<span><i style="background: {{.Fill}}"></i>{{.State}}</span>{{end}}</div>
+<p>Bars are time spent waiting on a barrier, circles are signal entries. Large circles mark the last instance to signal a state. Red outlined bars never released.</p>
+<svg xmlns="http://www.w3.org/2000/svg" width="{{.Width}}" height="{{.Height}}">
+{{range .Ticks}}<line x1="{{.X}}" y1="16" x2="{{.X}}" y2="{{$.Height}}" stroke="#ddd"/>
+<text x="{{.X}}" y="12" text-anchor="middle">{{.Label}}</text>
+{{end}}
+{{range .Lanes}}<rect x="0" y="{{.Y}}" width="{{$.Width}}" height="{{.H}}" fill="none" stroke="#eee"/>
+<text x="4" y="{{.Y}}" dy="12"{{if .Failed}} fill="#c00"{{end}}>{{.Label}}<title>{{.Detail}}</title></text>
+{{end}}
+{{range .Rects}}<rect x="{{.X}}" y="{{.Y}}" width="{{.W}}" height="{{.H}}" fill="{{.Fill}}" fill-opacity="0.7"{{if .Stuck}} stroke="#c00" stroke-width="2"{{end}}><title>{{.Title}}</title></rect>
+{{end}}
+{{range .Marks}}<circle cx="{{.X}}" cy="{{.Y}}" r="{{if .Last}}6{{else}}3{{end}}" fill="{{.Fill}}" stroke="#333"><title>{{.Title}}</title></circle>
+{{end}}
+</svg>
+{{if .Annotations}}<h4>barriers that never released</h4>
+<ul>{{range .Annotations}}<li>{{.}}</li>{{end}}</ul>{{end}}
+</body>
+</html>
+`))
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/qri-io/test-plans/plan"
+)
+
+// RunPlanScenario executes the declarative scenario file named by the
+// "scenario" test parameter. see the scenarios directory for examples
+func RunPlanScenario(ctx context.Context, p *plan.Plan) error {
+	path := p.Runenv.StringParam("scenario")
+	if path == "" {
+		return fmt.Errorf("the scenario test case requires a scenario file param")
+	}
+	sc, err := plan.LoadScenario(path)
+	if err != nil {
+		return err
+	}
+	return p.RunScenario(ctx, sc)
+}
@@ -2,18 +2,21 @@ package sim
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io/ioutil"
+	"math/rand"
 	"os"
 	"path/filepath"
 	"time"
 
+	"github.com/ipfs/go-cid"
 	"github.com/qri-io/dataset"
-	"github.com/qri-io/dataset/dsio"
-	"github.com/qri-io/dataset/generate"
 	"github.com/qri-io/ioes"
 	"github.com/qri-io/qfs"
+	"github.com/qri-io/qri/base"
 	"github.com/qri-io/qri/config"
+	"github.com/qri-io/qri/dsref"
 	"github.com/qri-io/qri/lib"
 	"github.com/qri-io/qri/repo/gen"
 
@@ -24,24 +27,27 @@ import (
 )
 
 var (
-	qriRepoPath string
 	// StateActorConstructed is the state to sync on to check if all the
 	// actors in the test have been constructed
 	StateActorConstructed = sync.State("actor has been constructed")
 )
 
-func init() {
-	tempDir, _ := ioutil.TempDir("", "remote_test_path")
-	qriRepoPath = filepath.Join(tempDir, "qri")
-}
-
 // Actor is a peer in a network simulation
 type Actor struct {
 	Inst  *lib.Instance
 	hooks *RemoteHooks
+	// seq is the actor's sequence number within the test
+	seq int64
+	// tempDir is the root directory holding this actor's qri & IPFS repos.
+	// each actor gets its own, so many actors can share a single process
+	tempDir string
+	// datasetRand seeds each dataset generator the actor creates
+	datasetRand *rand.Rand
 }
 
-// NewActor creates an actor instance
+// NewActor creates an actor instance, allocating an isolated on-disk repo.
+// The actor's libp2p host gets a bandwidth reporter, read with Bandwidth.
+// callers should Close the actor when finished to release the repo
 func NewActor(ctx context.Context, runenv *runtime.RunEnv, client sync.Client, seq int64, opts ...lib.Option) (*Actor, error) {
 	var listeningAddrs []string
 
@@ -50,11 +56,32 @@ func NewActor(ctx context.Context, runenv *runtime.RunEnv, client sync.Client, s
 		listeningAddrs = []string{fmt.Sprintf("/ip4/%s/tcp/0", ip)}
 	}
 
-	if err := setup(defaultQriActorConfig(listeningAddrs)); err != nil {
+	tempDir, err := ioutil.TempDir("", "remote_test_path")
+	if err != nil {
 		return nil, err
 	}
+	qriRepoPath := filepath.Join(tempDir, "qri")
 
-	hooks := &RemoteHooks{runenv: runenv, client: client}
+	if err := setup(qriRepoPath, defaultQriActorConfig(qriRepoPath, listeningAddrs)); err != nil {
+		os.RemoveAll(tempDir)
+		return nil, err
+	}
+	if err := enableBandwidthMetrics(filepath.Join(qriRepoPath, "ipfs")); err != nil {
+		os.RemoveAll(tempDir)
+		return nil, fmt.Errorf("enabling bandwidth metrics: %w", err)
+	}
+
+	events, err := newHookEventLog(runenv, client, seq)
+	if err != nil {
+		os.RemoveAll(tempDir)
+		return nil, err
+	}
+	hooks := &RemoteHooks{
+		runenv: runenv,
+		client: client,
+		events: events,
+		faults: newFaultInjector(HookFaultsFromRuntimeEnv(runenv), instanceSeed(runenv, HookFaultSeedParam, seq)),
+	}
 
 	libOpts := []lib.Option{
 		lib.OptIOStreams(ioes.NewStdIOStreams()),
@@ -67,19 +94,62 @@ func NewActor(ctx context.Context, runenv *runtime.RunEnv, client sync.Client, s
 
 	inst, err := lib.NewInstance(ctx, qriRepoPath, libOpts...)
 	if err != nil {
+		events.Close()
+		os.RemoveAll(tempDir)
 		return nil, err
 	}
 
 	act := &Actor{
-		Inst:  inst,
-		hooks: hooks,
+		Inst:        inst,
+		hooks:       hooks,
+		seq:         seq,
+		tempDir:     tempDir,
+		datasetRand: rand.New(rand.NewSource(instanceSeed(runenv, DatasetSeedParam, seq))),
 	}
 
 	return act, nil
 }
 
-// setup initializes on-disk IPFS & qri repos, generates private keys
-func setup(cfg *config.Config) error {
+// Close shuts down the actor's qri instance & removes its on-disk repo
+func (a *Actor) Close() error {
+	var err error
+	if a.Inst != nil {
+		err = <-a.Inst.Shutdown()
+		if errors.Is(err, context.Canceled) {
+			err = nil
+		}
+	}
+	if closeErr := a.hooks.events.Close(); closeErr != nil && err == nil {
+		err = closeErr
+	}
+	if rmErr := os.RemoveAll(a.tempDir); rmErr != nil && err == nil {
+		err = rmErr
+	}
+	return err
+}
+
+// LogbookSize returns the size in bytes of the actor's logbook on disk
+func (a *Actor) LogbookSize() (int64, error) {
+	fi, err := os.Stat(filepath.Join(a.RepoPath(), "logbook.qfb"))
+	if err != nil {
+		return 0, err
+	}
+	return fi.Size(), nil
+}
+
+// Hooks returns the hooks this actor runs when acting as a remote
+func (a *Actor) Hooks() *RemoteHooks {
+	return a.hooks
+}
+
+// RepoPath returns the path to this actor's qri repo
+func (a *Actor) RepoPath() string {
+	return filepath.Join(a.tempDir, "qri")
+}
+
+// setup initializes on-disk IPFS & qri repos at qriRepoPath, generates private
+// keys
+func setup(qriRepoPath string, cfg *config.Config) error {
 	p := lib.SetupParams{
 		SetupIPFS: true,
 		Register:  false,
@@ -103,7 +173,7 @@ type ActorInfo struct {
 func (a *Actor) Info(runenv *runtime.RunEnv) *ActorInfo {
 	pro, _ := a.Inst.Repo().Profile()
 	return &ActorInfo{
-		Seq:       runenv.TestInstanceCount,
+		Seq:       int(a.seq),
 		Peername:  pro.Peername,
 		ProfileID: pro.ID.String(),
 		AddrInfo:  a.AddrInfo(),
@@ -132,18 +202,142 @@ func (a *Actor) AddrInfo() *peer.AddrInfo {
 	}
 }
 
+// DAGSize returns the number of blocks in the DAG rooted at path, which must be
+// stored locally, & the sum of their raw sizes. Each block is counted once, so
+// this is the size of the DAG, not the number of bytes it took to transfer it
+func (a *Actor) DAGSize(ctx context.Context, path string) (blocks int, size uint64, err error) {
+	cids, err := a.DAGNodes(ctx, path)
+	if err != nil {
+		return 0, 0, err
+	}
+	node, err := a.Inst.Node().IPFS()
+	if err != nil {
+		return 0, 0, err
+	}
+	for _, s := range cids {
+		id, err := cid.Decode(s)
+		if err != nil {
+			return 0, 0, fmt.Errorf("decoding cid %q: %w", s, err)
+		}
+		// dag info sizes are cumulative, counting blocks once for every
+		// parent that links to them. use the size of each block instead
+		n, err := node.Blockstore.GetSize(id)
+		if err != nil {
+			return 0, 0, err
+		}
+		size += uint64(n)
+	}
+	return len(cids), size, nil
+}
+
+// DAGNodes lists the CID of every block in the DAG rooted at path, which must
+// be stored locally
+func (a *Actor) DAGNodes(ctx context.Context, path string) ([]string, error) {
+	info, err := a.Inst.Node().NewDAGInfo(ctx, path, "")
+	if err != nil {
+		return nil, err
+	}
+	return info.Manifest.Nodes, nil
+}
+
+// HasBlocks counts how many of the given CIDs are in the actor's local
+// blockstore. It works on partial DAGs, so it can check how much of an
+// interrupted transfer arrived
+func (a *Actor) HasBlocks(cids []string) (int, error) {
+	node, err := a.Inst.Node().IPFS()
+	if err != nil {
+		return 0, err
+	}
+	count := 0
+	for _, s := range cids {
+		id, err := cid.Decode(s)
+		if err != nil {
+			return count, fmt.Errorf("decoding cid %q: %w", s, err)
+		}
+		has, err := node.Blockstore.Has(id)
+		if err != nil {
+			return count, err
+		}
+		if has {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// DatasetStats describes the stored head version of a dataset
+type DatasetStats struct {
+	// Path is the root CID path of the version
+	Path string
+	// BodyBytes is the size of the body, as recorded in the dataset structure
+	BodyBytes int
+	// BodyRows is the number of entries in the body
+	BodyRows int
+	// Blocks & DAGBytes count the blocks & raw block bytes of the whole
+	// version DAG
+	Blocks   int
+	DAGBytes uint64
+}
+
+// DatasetStats resolves the head of one of the actor's datasets & measures it
+func (a *Actor) DatasetStats(ctx context.Context, name string) (*DatasetStats, error) {
+	ref := &dsref.Ref{Username: a.Peername(), Name: name}
+	ds, err := a.ReadDataset(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+	blocks, size, err := a.DAGSize(ctx, ref.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &DatasetStats{Path: ref.Path, Blocks: blocks, DAGBytes: size}
+	if ds.Structure != nil {
+		stats.BodyBytes = ds.Structure.Length
+		stats.BodyRows = ds.Structure.Entries
+	}
+	return stats, nil
+}
+
+// ReadDataset resolves ref against the actor's local repo, filling in its
+// path, & reads the dataset version it refers to
+func (a *Actor) ReadDataset(ctx context.Context, ref *dsref.Ref) (*dataset.Dataset, error) {
+	if _, err := a.Inst.ResolveReference(ctx, ref, "local"); err != nil {
+		return nil, fmt.Errorf("resolving %s: %w", ref.Human(), err)
+	}
+	ds, err := base.ReadDataset(ctx, a.Inst.Repo(), ref.Path)
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", ref.Human(), err)
+	}
+	return ds, nil
+}
+
+// NewDatasetGenerator creates a generator for shape, seeded from the
+// datasetSeed param & the actor's sequence number. An actor that creates
+// generators in the same order in two runs with the same seed generates the
+// same bodies. NewDatasetGenerator isn't safe for concurrent use
+func (a *Actor) NewDatasetGenerator(shape DatasetShape) (DatasetGenerator, error) {
+	return NewDatasetGenerator(shape, a.datasetRand.Int63())
+}
+
 // GenerateDatasetVersion creates & Saves a new version of a dataset
 // Datasets are generic CSV datasets with only the number of rows configurable
 // We're trying to test the network here. Size should be the only real concern
 func (a *Actor) GenerateDatasetVersion(name string, numRows int) error {
-	csvFilepath, err := generateRandomCSVFile(numRows)
+	csvFilepath, err := a.generateRandomCSVFile(numRows)
 	if err != nil {
 		return err
 	}
+	defer os.Remove(csvFilepath)
+	return a.saveBody(name, csvFilepath)
+}
 
+// saveBody saves a new version of the named dataset with the body file at
+// bodyPath
+func (a *Actor) saveBody(name, bodyPath string) error {
 	p := &lib.SaveParams{
 		Ref:        fmt.Sprintf("me/%s", name),
-		BodyPath:   csvFilepath,
+		BodyPath:   bodyPath,
 		UseDscache: true,
 	}
 
@@ -154,55 +348,18 @@ func (a *Actor) GenerateDatasetVersion(name string, numRows int) error {
 // // MarkDatasetAsPublished
 // func (a *Actor)
 
-func generateRandomCSVFile(numRows int) (string, error) {
-	st := &dataset.Structure{
-		Format: "csv",
-		FormatConfig: map[string]interface{}{
-			"headerRow": true,
-		},
-		Schema: map[string]interface{}{
-			"type": "array",
-			"items": map[string]interface{}{
-				"type": "array",
-				"items": []interface{}{
-					map[string]interface{}{"title": "id", "type": "string"},
-					map[string]interface{}{"title": "date", "type": "string"},
-					map[string]interface{}{"title": "count", "type": "integer"},
-					map[string]interface{}{"title": "data", "type": "string"},
-				},
-			},
-		},
-	}
-	gen, err := generate.NewTabularGenerator(st)
+func (a *Actor) generateRandomCSVFile(numRows int) (string, error) {
+	gen, err := a.NewDatasetGenerator(ShapeDefault)
 	if err != nil {
 		return "", err
 	}
-
-	f, err := ioutil.TempFile("", "body.*.csv")
-	if err != nil {
-		return "", err
-	}
-
-	w, err := dsio.NewCSVWriter(st, f)
-	if err != nil {
+	if err := gen.Init(numRows); err != nil {
 		return "", err
 	}
-
-	for i := 0; i < numRows; i++ {
-		ent, err := gen.ReadEntry()
-		if err != nil {
-			fmt.Println(err)
-			os.Exit(1)
-		}
-		w.WriteEntry(ent)
-	}
-	w.Close()
-	gen.Close()
-
-	return f.Name(), nil
+	return gen.WriteFile()
 }
 
-func defaultQriActorConfig(listeningAddrs []string) *config.Config {
+func defaultQriActorConfig(qriRepoPath string, listeningAddrs []string) *config.Config {
 	return &config.Config{
 		Profile: &config.ProfilePod{
 			Type:    "peer",
@@ -0,0 +1,109 @@
+package sim
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/libp2p/go-libp2p-core/metrics"
+)
+
+// ErrNoBandwidthReporter is returned when an actor's host has no bandwidth
+// reporter, which happens when qri builds its own libp2p host instead of
+// using the IPFS node's
+var ErrNoBandwidthReporter = errors.New("host has no bandwidth reporter")
+
+// Protocol families group libp2p protocols for bandwidth accounting
+const (
+	// ProtocolFamilyQri covers qri's own protocols, including logsync & dsync
+	ProtocolFamilyQri      = "qri"
+	ProtocolFamilyBitswap  = "bitswap"
+	ProtocolFamilyIdentify = "identify"
+	ProtocolFamilyOther    = "other"
+)
+
+// ProtocolFamily returns the family a libp2p protocol ID belongs to
+func ProtocolFamily(proto string) string {
+	switch {
+	case strings.HasPrefix(proto, "/qri"), strings.HasPrefix(proto, "/dsync"):
+		return ProtocolFamilyQri
+	case strings.HasPrefix(proto, "/ipfs/bitswap"):
+		return ProtocolFamilyBitswap
+	case strings.HasPrefix(proto, "/ipfs/id/"), strings.HasPrefix(proto, "/p2p/id/"):
+		return ProtocolFamilyIdentify
+	}
+	return ProtocolFamilyOther
+}
+
+// BandwidthStats are the bytes an actor's host has sent & received since it
+// came online
+type BandwidthStats struct {
+	Total metrics.Stats
+	// ByProtocol is keyed by libp2p protocol ID
+	ByProtocol map[string]metrics.Stats
+	// ByPeer is keyed by libp2p peer ID
+	ByPeer map[string]metrics.Stats
+}
+
+// Bandwidth reads the bandwidth reporter attached to the actor's libp2p host.
+// Byte counts are folded into totals once a second, so traffic from the last
+// second may not be counted yet
+func (a *Actor) Bandwidth() (*BandwidthStats, error) {
+	node, err := a.Inst.Node().IPFS()
+	if err != nil {
+		return nil, ErrNoBandwidthReporter
+	}
+	if node.Reporter == nil {
+		return nil, ErrNoBandwidthReporter
+	}
+
+	stats := &BandwidthStats{
+		Total:      node.Reporter.GetBandwidthTotals(),
+		ByProtocol: map[string]metrics.Stats{},
+		ByPeer:     map[string]metrics.Stats{},
+	}
+	for proto, s := range node.Reporter.GetBandwidthByProtocol() {
+		stats.ByProtocol[string(proto)] = s
+	}
+	for pid, s := range node.Reporter.GetBandwidthByPeer() {
+		stats.ByPeer[pid.Pretty()] = s
+	}
+	return stats, nil
+}
+
+// enableBandwidthMetrics makes sure the IPFS node whose repo is at ipfsPath
+// attaches a bandwidth reporter to its libp2p host when it goes online
+func enableBandwidthMetrics(ipfsPath string) error {
+	path := filepath.Join(ipfsPath, "config")
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	cfg := map[string]interface{}{}
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return err
+	}
+
+	swarm, ok := cfg["Swarm"].(map[string]interface{})
+	if !ok {
+		swarm = map[string]interface{}{}
+		cfg["Swarm"] = swarm
+	}
+	if disabled, _ := swarm["DisableBandwidthMetrics"].(bool); !disabled {
+		return nil
+	}
+	swarm["DisableBandwidthMetrics"] = false
+
+	data, err = json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		return err
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, fi.Mode())
+}
@@ -0,0 +1,79 @@
+package sim
+
+import (
+	"sort"
+	"time"
+
+	"github.com/libp2p/go-libp2p-core/network"
+)
+
+// ConnInfo describes a single libp2p connection held by an actor
+type ConnInfo struct {
+	// PeerID is the peer on the other end of the connection
+	PeerID string `json:"peerID"`
+	// Direction is "inbound" if the other peer dialed, "outbound" if this
+	// actor dialed, or "unknown"
+	Direction  string `json:"direction"`
+	LocalAddr  string `json:"localAddr"`
+	RemoteAddr string `json:"remoteAddr"`
+	// Streams lists the protocols of the streams open on the connection when
+	// the snapshot was taken
+	Streams []string `json:"streams,omitempty"`
+	// Protocols lists the protocols the other peer supports, as learned
+	// through identify
+	Protocols []string `json:"protocols,omitempty"`
+}
+
+// ConnSnapshot is the set of connections an actor's libp2p host held at a
+// point in time
+type ConnSnapshot struct {
+	Seq    int64      `json:"seq"`
+	PeerID string     `json:"peerID"`
+	Time   time.Time  `json:"time"`
+	Conns  []ConnInfo `json:"conns"`
+}
+
+// Connections snapshots the connections the actor's libp2p host holds, in
+// order of peer ID
+func (a *Actor) Connections() *ConnSnapshot {
+	h := a.Inst.Node().Host()
+	snap := &ConnSnapshot{
+		Seq:    a.seq,
+		PeerID: h.ID().Pretty(),
+		Time:   time.Now(),
+	}
+
+	for _, c := range h.Network().Conns() {
+		remote := c.RemotePeer()
+		info := ConnInfo{
+			PeerID:     remote.Pretty(),
+			Direction:  directionString(c.Stat().Direction),
+			LocalAddr:  c.LocalMultiaddr().String(),
+			RemoteAddr: c.RemoteMultiaddr().String(),
+		}
+		for _, s := range c.GetStreams() {
+			if p := s.Protocol(); p != "" {
+				info.Streams = append(info.Streams, string(p))
+			}
+		}
+		sort.Strings(info.Streams)
+		if protos, err := h.Peerstore().GetProtocols(remote); err == nil {
+			sort.Strings(protos)
+			info.Protocols = protos
+		}
+		snap.Conns = append(snap.Conns, info)
+	}
+
+	sort.Slice(snap.Conns, func(i, j int) bool { return snap.Conns[i].PeerID < snap.Conns[j].PeerID })
+	return snap
+}
+
+func directionString(d network.Direction) string {
+	switch d {
+	case network.DirInbound:
+		return "inbound"
+	case network.DirOutbound:
+		return "outbound"
+	}
+	return "unknown"
+}
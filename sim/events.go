@@ -0,0 +1,111 @@
+package sim
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	gosync "sync"
+	"time"
+
+	"github.com/qri-io/qri/dsref"
+	"github.com/qri-io/qri/repo/profile"
+	"github.com/testground/sdk-go/runtime"
+	"github.com/testground/sdk-go/sync"
+)
+
+// Names of the remote hooks, used in hook events & injected faults
+const (
+	HookAcceptPushPreCheck    = "acceptPushPreCheck"
+	HookAcceptPushFinalCheck  = "acceptPushFinalCheck"
+	HookDatasetPushed         = "datasetPushed"
+	HookDatasetPullPreCheck   = "datasetPullPreCheck"
+	HookDatasetPulled         = "datasetPulled"
+	HookDatasetRemovePreCheck = "datasetRemovePreCheck"
+	HookDatasetRemoved        = "datasetRemoved"
+	HookLogPushPreCheck       = "logPushPreCheck"
+	HookLogPushFinalCheck     = "logPushFinalCheck"
+	HookLogPushed             = "logPushed"
+	HookLogRemoved            = "logRemoved"
+)
+
+// HookEventsAsset returns the name of the output file the actor with seq
+// writes hook events to, one JSON object per line. names are unique per seq so
+// actors sharing an outputs path don't truncate each other's events
+func HookEventsAsset(seq int64) string {
+	return fmt.Sprintf("hook_events_%d.jsonl", seq)
+}
+
+// HookEvent records a single remote hook invocation
+type HookEvent struct {
+	Hook      string    `json:"hook"`
+	ProfileID string    `json:"profileID"`
+	Ref       string    `json:"ref"`
+	Seq       int64     `json:"seq"`
+	Time      time.Time `json:"time"`
+	// Monotonic is the number of nanoseconds since the instance's hooks were
+	// created, read from a monotonic clock. It orders events within an
+	// instance even if the wall clock jumps. Time orders events across
+	// instances
+	Monotonic int64 `json:"monotonic"`
+}
+
+// HookEventTopic carries every hook event from every instance in a run
+var HookEventTopic = sync.NewTopic("hook-event", &HookEvent{})
+
+// hookEventLog writes hook events to an output file & the HookEventTopic
+type hookEventLog struct {
+	runenv *runtime.RunEnv
+	client sync.Client
+	seq    int64
+	start  time.Time
+
+	lk  gosync.Mutex
+	f   *os.File
+	enc *json.Encoder
+}
+
+func newHookEventLog(runenv *runtime.RunEnv, client sync.Client, seq int64) (*hookEventLog, error) {
+	f, err := runenv.CreateRawAsset(HookEventsAsset(seq))
+	if err != nil {
+		return nil, err
+	}
+	return &hookEventLog{
+		runenv: runenv,
+		client: client,
+		seq:    seq,
+		start:  time.Now(),
+		f:      f,
+		enc:    json.NewEncoder(f),
+	}, nil
+}
+
+// record writes an event for a hook invocation. failures are logged instead
+// of returned so recording never changes the outcome of a hook
+func (l *hookEventLog) record(ctx context.Context, hook string, pid profile.ID, ref dsref.Ref) {
+	evt := &HookEvent{
+		Hook:      hook,
+		ProfileID: pid.String(),
+		Ref:       ref.String(),
+		Seq:       l.seq,
+		Time:      time.Now(),
+		Monotonic: int64(time.Since(l.start)),
+	}
+
+	l.lk.Lock()
+	err := l.enc.Encode(evt)
+	l.lk.Unlock()
+	if err != nil {
+		l.runenv.RecordMessage("error writing hook event: %s", err)
+	}
+	if _, err := l.client.Publish(ctx, HookEventTopic, evt); err != nil {
+		l.runenv.RecordMessage("error publishing hook event: %s", err)
+	}
+}
+
+// Close closes the events file
+func (l *hookEventLog) Close() error {
+	l.lk.Lock()
+	defer l.lk.Unlock()
+	return l.f.Close()
+}
@@ -0,0 +1,88 @@
+package sim
+
+import (
+	"errors"
+	"math/rand"
+	"time"
+
+	"github.com/qri-io/qri/dsref"
+	"github.com/testground/sdk-go/runtime"
+)
+
+// ErrInjectedFault is returned by remote hooks configured to reject requests
+var ErrInjectedFault = errors.New("injected fault")
+
+// HookFaultSeedParam is the test param seeding which requests hooks reject
+const HookFaultSeedParam = "hook_fault_seed"
+
+// HookFaults configures failures RemoteHooks inject into qri's remote
+// protocol. The zero value injects nothing
+type HookFaults struct {
+	// PushRejectRate is the probability from 0 to 1 acceptPushPreCheck rejects
+	// a dataset push
+	PushRejectRate float64
+	// PushFinalCheckDelay is how long acceptPushFinalCheck waits before
+	// accepting a push
+	PushFinalCheckDelay time.Duration
+	// FailLogPushFinalCheck rejects every log push in logPushFinalCheck. qri
+	// doesn't call log hooks over p2p
+	FailLogPushFinalCheck bool
+	// PullRejectRate is the probability from 0 to 1 datasetPulled rejects a
+	// pull. qri calls datasetPulled before sending any blocks
+	PullRejectRate float64
+}
+
+// HookFaultsFromRuntimeEnv reads hook faults from the runtime environment.
+// Missing params inject nothing
+func HookFaultsFromRuntimeEnv(runenv *runtime.RunEnv) HookFaults {
+	f := HookFaults{}
+	if runenv.IsParamSet("hook_push_reject_rate") {
+		f.PushRejectRate = runenv.FloatParam("hook_push_reject_rate")
+	}
+	if runenv.IsParamSet("hook_push_final_delay_ms") {
+		f.PushFinalCheckDelay = time.Duration(runenv.IntParam("hook_push_final_delay_ms")) * time.Millisecond
+	}
+	if runenv.IsParamSet("hook_log_push_final_fail") {
+		f.FailLogPushFinalCheck = runenv.BooleanParam("hook_log_push_final_fail")
+	}
+	if runenv.IsParamSet("hook_pull_reject_rate") {
+		f.PullRejectRate = runenv.FloatParam("hook_pull_reject_rate")
+	}
+	return f
+}
+
+// Enabled reports whether any fault is configured
+func (f HookFaults) Enabled() bool {
+	return f.PushRejectRate > 0 || f.PushFinalCheckDelay > 0 || f.FailLogPushFinalCheck || f.PullRejectRate > 0
+}
+
+// InjectedFault records a request a remote hook rejected
+type InjectedFault struct {
+	// Hook is the name of the hook that rejected the request
+	Hook string
+	// ProfileID is the profile ID of the requesting peer
+	ProfileID string
+	// Ref is the dataset reference the request was for
+	Ref dsref.Ref
+}
+
+// faultInjector decides when hooks inject faults, safe for concurrent use
+// when called with the hooks lock held
+type faultInjector struct {
+	HookFaults
+	rand *rand.Rand
+}
+
+// newFaultInjector creates an injector for f. injectors with the same seed
+// that see requests in the same order reject the same requests
+func newFaultInjector(f HookFaults, seed int64) *faultInjector {
+	return &faultInjector{
+		HookFaults: f,
+		rand:       rand.New(rand.NewSource(seed)),
+	}
+}
+
+// roll returns true with the given probability
+func (f *faultInjector) roll(rate float64) bool {
+	return rate > 0 && f.rand.Float64() < rate
+}
@@ -0,0 +1,391 @@
+package sim
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"strings"
+
+	"github.com/qri-io/dataset"
+	"github.com/qri-io/dataset/dsio"
+	"github.com/qri-io/dataset/generate"
+	"github.com/testground/sdk-go/runtime"
+)
+
+// DatasetGenerator creates dataset bodies. Generators hold the last body they
+// created, so mutating it produces the next version of a dataset history
+type DatasetGenerator interface {
+	// Init creates a new body with numRows entries
+	Init(numRows int) error
+	// Mutate changes the body to create the next version of a dataset
+	Mutate(m Mutation) error
+	// WriteFile writes the body to a temp file with an extension qri can
+	// detect the body format from, returning the file's path. callers are
+	// responsible for removing the file
+	WriteFile() (string, error)
+}
+
+// DatasetShape names a built-in DatasetGenerator
+type DatasetShape string
+
+const (
+	// ShapeDefault is a four column CSV of random values
+	ShapeDefault = DatasetShape("default")
+	// ShapeWide is a CSV with 100 columns of random values
+	ShapeWide = DatasetShape("wide")
+	// ShapeLong is a narrow, two column CSV of random integers. Entries are
+	// small, so a long table can have many rows for its size
+	ShapeLong = DatasetShape("long")
+	// ShapeNested is a JSON array of deeply nested objects
+	ShapeNested = DatasetShape("nested")
+	// ShapeCompressible is a four column CSV where every row is the same
+	ShapeCompressible = DatasetShape("compressible")
+	// ShapeIncompressible is a four column CSV of random base64 strings
+	ShapeIncompressible = DatasetShape("incompressible")
+)
+
+// DatasetShapes lists all built-in dataset shapes
+var DatasetShapes = []DatasetShape{ShapeDefault, ShapeWide, ShapeLong, ShapeNested, ShapeCompressible, ShapeIncompressible}
+
+// DatasetSeedParam is the test param seeding generated dataset bodies
+const DatasetSeedParam = "datasetSeed"
+
+// instanceSeed derives a seed for one instance's random choices from the int
+// param named param, or the run ID if the param isn't set, mixed with the
+// instance's sequence number. Instances in a run make different choices, but
+// two runs with the same param make the same ones
+func instanceSeed(runenv *runtime.RunEnv, param string, seq int64) int64 {
+	h := fnv.New64a()
+	if runenv.IsParamSet(param) {
+		fmt.Fprintf(h, "%d", runenv.IntParam(param))
+	} else {
+		h.Write([]byte(runenv.TestRun))
+	}
+	fmt.Fprintf(h, "/%d", seq)
+	return int64(h.Sum64())
+}
+
+// NewDatasetGenerator creates the built-in generator for a shape, seeded with
+// seed. Generators of the same shape & seed create the same bodies. An empty
+// shape is ShapeDefault
+func NewDatasetGenerator(shape DatasetShape, seed int64) (DatasetGenerator, error) {
+	rnd := rand.New(rand.NewSource(seed))
+	random := &generate.ValueGenerator{Rand: rnd, MaxStringLength: 64}
+
+	switch shape {
+	case "", ShapeDefault:
+		return newTabularBody(rnd, defaultColumns(), random.Type), nil
+	case ShapeWide:
+		types := []string{"string", "integer", "number", "boolean"}
+		cols := make([]interface{}, 100)
+		for i := range cols {
+			cols[i] = column(fmt.Sprintf("col_%d", i), types[i%len(types)])
+		}
+		return newTabularBody(rnd, cols, random.Type), nil
+	case ShapeLong:
+		cols := []interface{}{column("id", "integer"), column("value", "integer")}
+		return newTabularBody(rnd, cols, random.Type), nil
+	case ShapeNested:
+		return &nestedBody{rand: rnd, random: random}, nil
+	case ShapeCompressible:
+		return newTabularBody(rnd, defaultColumns(), constantValue), nil
+	case ShapeIncompressible:
+		cols := make([]interface{}, 4)
+		for i := range cols {
+			cols[i] = column(fmt.Sprintf("col_%d", i), "string")
+		}
+		return newTabularBody(rnd, cols, func(string) interface{} {
+			return randomBase64(rnd, 48)
+		}), nil
+	}
+	return nil, fmt.Errorf("unknown dataset shape %q, must be one of %v", shape, DatasetShapes)
+}
+
+func column(title, typ string) map[string]interface{} {
+	return map[string]interface{}{"title": title, "type": typ}
+}
+
+func defaultColumns() []interface{} {
+	return []interface{}{
+		column("id", "string"),
+		column("date", "string"),
+		column("count", "integer"),
+		column("data", "string"),
+	}
+}
+
+// constantValue returns the same value for every cell of a type
+func constantValue(typ string) interface{} {
+	switch typ {
+	case "integer":
+		return 1
+	case "number":
+		return 1.5
+	case "boolean":
+		return true
+	}
+	return strings.Repeat("a", 32)
+}
+
+// randomBase64 encodes n random bytes as base64
+func randomBase64(rnd *rand.Rand, n int) string {
+	buf := make([]byte, n)
+	rnd.Read(buf)
+	return base64.StdEncoding.EncodeToString(buf)
+}
+
+// mutationSize is the number of entries appended or changed by a mutation
+func mutationSize(initialRows int) int {
+	if n := initialRows / 10; n > 0 {
+		return n
+	}
+	return 1
+}
+
+// tabularBody is an in-memory CSV dataset body
+type tabularBody struct {
+	columns     []interface{}
+	rows        [][]interface{}
+	initialRows int
+	rand        *rand.Rand
+	// cell creates a value for a column of the given JSON schema type
+	cell func(typ string) interface{}
+}
+
+var _ DatasetGenerator = (*tabularBody)(nil)
+
+func newTabularBody(rnd *rand.Rand, columns []interface{}, cell func(typ string) interface{}) *tabularBody {
+	return &tabularBody{
+		columns: columns,
+		rand:    rnd,
+		cell:    cell,
+	}
+}
+
+// Init implements the DatasetGenerator interface
+func (b *tabularBody) Init(numRows int) error {
+	b.initialRows = numRows
+	b.rows = make([][]interface{}, numRows)
+	for i := range b.rows {
+		b.rows[i] = b.newRow()
+	}
+	return nil
+}
+
+func (b *tabularBody) structure() *dataset.Structure {
+	return &dataset.Structure{
+		Format: "csv",
+		FormatConfig: map[string]interface{}{
+			"headerRow": true,
+		},
+		Schema: map[string]interface{}{
+			"type": "array",
+			"items": map[string]interface{}{
+				"type":  "array",
+				"items": b.columns,
+			},
+		},
+	}
+}
+
+func (b *tabularBody) newRow() []interface{} {
+	row := make([]interface{}, len(b.columns))
+	for i, col := range b.columns {
+		row[i] = b.cell(col.(map[string]interface{})["type"].(string))
+	}
+	return row
+}
+
+// Mutate implements the DatasetGenerator interface
+func (b *tabularBody) Mutate(m Mutation) error {
+	switch m {
+	case MutationAppend:
+		for i := 0; i < mutationSize(b.initialRows); i++ {
+			b.rows = append(b.rows, b.newRow())
+		}
+	case MutationChange:
+		if len(b.rows) == 0 {
+			return nil
+		}
+		for i := 0; i < mutationSize(b.initialRows); i++ {
+			b.rows[b.rand.Intn(len(b.rows))] = b.newRow()
+		}
+	case MutationSchema:
+		b.columns = append(b.columns, column(fmt.Sprintf("extra_%d", len(b.columns)), "integer"))
+		for i, row := range b.rows {
+			b.rows[i] = append(row, b.cell("integer"))
+		}
+	default:
+		return fmt.Errorf("unknown mutation %q", m)
+	}
+	return nil
+}
+
+// WriteFile implements the DatasetGenerator interface
+func (b *tabularBody) WriteFile() (string, error) {
+	f, err := ioutil.TempFile("", "body.*.csv")
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	w, err := dsio.NewCSVWriter(b.structure(), f)
+	if err != nil {
+		return "", err
+	}
+	for i, row := range b.rows {
+		if err := w.WriteEntry(dsio.Entry{Index: i, Value: row}); err != nil {
+			return "", err
+		}
+	}
+	if err := w.Close(); err != nil {
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// nestedBody is an in-memory JSON dataset body of nested objects
+type nestedBody struct {
+	entries     []map[string]interface{}
+	initialRows int
+	extraFields int
+	rand        *rand.Rand
+	random      *generate.ValueGenerator
+}
+
+var _ DatasetGenerator = (*nestedBody)(nil)
+
+// Init implements the DatasetGenerator interface
+func (b *nestedBody) Init(numRows int) error {
+	b.initialRows = numRows
+	b.entries = make([]map[string]interface{}, numRows)
+	for i := range b.entries {
+		b.entries[i] = b.newEntry()
+	}
+	return nil
+}
+
+func (b *nestedBody) newEntry() map[string]interface{} {
+	tags := make([]interface{}, b.rand.Intn(5))
+	for i := range tags {
+		tags[i] = b.random.String()
+	}
+	entry := map[string]interface{}{
+		"id":   b.random.String(),
+		"tags": tags,
+		"location": map[string]interface{}{
+			"lat": b.random.Float(),
+			"lng": b.random.Float(),
+			"address": map[string]interface{}{
+				"street": b.random.String(),
+				"city":   b.random.String(),
+			},
+		},
+		"metrics": map[string]interface{}{
+			"count":  b.random.Int(),
+			"active": b.random.Bool(),
+			"history": []interface{}{
+				map[string]interface{}{"value": b.random.Float()},
+				map[string]interface{}{"value": b.random.Float()},
+			},
+		},
+	}
+	for i := 0; i < b.extraFields; i++ {
+		entry[fmt.Sprintf("extra_%d", i)] = b.extraField()
+	}
+	return entry
+}
+
+func (b *nestedBody) extraField() map[string]interface{} {
+	return map[string]interface{}{"value": b.random.Int()}
+}
+
+// Mutate implements the DatasetGenerator interface
+func (b *nestedBody) Mutate(m Mutation) error {
+	switch m {
+	case MutationAppend:
+		for i := 0; i < mutationSize(b.initialRows); i++ {
+			b.entries = append(b.entries, b.newEntry())
+		}
+	case MutationChange:
+		if len(b.entries) == 0 {
+			return nil
+		}
+		for i := 0; i < mutationSize(b.initialRows); i++ {
+			b.entries[b.rand.Intn(len(b.entries))] = b.newEntry()
+		}
+	case MutationSchema:
+		name := fmt.Sprintf("extra_%d", b.extraFields)
+		b.extraFields++
+		for _, entry := range b.entries {
+			entry[name] = b.extraField()
+		}
+	default:
+		return fmt.Errorf("unknown mutation %q", m)
+	}
+	return nil
+}
+
+// WriteFile implements the DatasetGenerator interface
+func (b *nestedBody) WriteFile() (string, error) {
+	f, err := ioutil.TempFile("", "body.*.json")
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	if err := json.NewEncoder(f).Encode(b.entries); err != nil {
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// sampleRows is the number of entries RowsForBytes measures to estimate the
+// size of an entry
+const sampleRows = 200
+
+// RowsForBytes estimates the number of entries gen must create for a body of
+// targetBytes, by writing a sample body & measuring its size. Entry sizes
+// vary, so bodies generated with the estimate are close to, but rarely
+// exactly, targetBytes. RowsForBytes calls Init, so it must be called before
+// generating a body
+func RowsForBytes(gen DatasetGenerator, targetBytes int64) (int, error) {
+	empty, err := sampleSize(gen, 0)
+	if err != nil {
+		return 0, err
+	}
+	sample, err := sampleSize(gen, sampleRows)
+	if err != nil {
+		return 0, err
+	}
+
+	perRow := float64(sample-empty) / sampleRows
+	if perRow <= 0 {
+		return 0, fmt.Errorf("generator created an empty sample body")
+	}
+	if rows := int(float64(targetBytes-empty)/perRow + 0.5); rows > 0 {
+		return rows, nil
+	}
+	return 1, nil
+}
+
+// sampleSize writes a body with numRows entries, returning its size in bytes
+func sampleSize(gen DatasetGenerator, numRows int) (int64, error) {
+	if err := gen.Init(numRows); err != nil {
+		return 0, err
+	}
+	path, err := gen.WriteFile()
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(path)
+	fi, err := os.Stat(path)
+	if err != nil {
+		return 0, err
+	}
+	return fi.Size(), nil
+}
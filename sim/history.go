@@ -0,0 +1,58 @@
+package sim
+
+import (
+	"fmt"
+	"os"
+)
+
+// Mutation describes how each version in a generated dataset history differs
+// from the version before it
+type Mutation string
+
+const (
+	// MutationAppend adds a tenth as many entries as the first version had
+	MutationAppend = Mutation("append")
+	// MutationChange replaces a tenth of all entries with new random entries
+	MutationChange = Mutation("change")
+	// MutationSchema adds a column or field to every entry in the body
+	MutationSchema = Mutation("schema")
+)
+
+// ParseMutation converts a string to a Mutation, an empty string is
+// MutationAppend
+func ParseMutation(s string) (Mutation, error) {
+	switch m := Mutation(s); m {
+	case "":
+		return MutationAppend, nil
+	case MutationAppend, MutationChange, MutationSchema:
+		return m, nil
+	}
+	return "", fmt.Errorf("unknown mutation %q, must be one of %q, %q or %q", s, MutationAppend, MutationChange, MutationSchema)
+}
+
+// GenerateDatasetHistory saves versions versions of a dataset with bodies
+// created by gen. The first version has numRows entries, each following
+// version applies mutation to the version before it
+func (a *Actor) GenerateDatasetHistory(name string, gen DatasetGenerator, numRows, versions int, mutation Mutation) error {
+	if err := gen.Init(numRows); err != nil {
+		return err
+	}
+
+	for v := 0; v < versions; v++ {
+		if v > 0 {
+			if err := gen.Mutate(mutation); err != nil {
+				return err
+			}
+		}
+		bodyPath, err := gen.WriteFile()
+		if err != nil {
+			return err
+		}
+		err = a.saveBody(name, bodyPath)
+		os.Remove(bodyPath)
+		if err != nil {
+			return fmt.Errorf("saving version %d of %q: %w", v+1, name, err)
+		}
+	}
+	return nil
+}
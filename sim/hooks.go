@@ -3,6 +3,8 @@ package sim
 import (
 	"context"
 	"fmt"
+	gosync "sync"
+	"time"
 
 	"github.com/qri-io/qri/dsref"
 	"github.com/qri-io/qri/lib"
@@ -19,8 +21,18 @@ var (
 	ErrAlreadyPushed = fmt.Errorf("this dataset has already been published")
 	// StatePushAttempted is the state to sync on once a pusher has tried to
 	// push its dataset to all remotes, regardless of if the attempt was
-	// successful
+	// successful. only pushers signal it, once each
 	StatePushAttempted = sync.State("push to all remotes attempted")
+	// StatePushSent is signalled by a pusher each time it finishes trying to
+	// push a dataset to a single remote, regardless of if the attempt was
+	// successful
+	StatePushSent = sync.State("push sent")
+	// StatePushReceived is signalled by a remote each time it receives a
+	// complete dataset push
+	StatePushReceived = sync.State("push received")
+	// StatePullServed is signalled by a remote each time it accepts a client's
+	// request to pull a dataset, before sending any blocks
+	StatePullServed = sync.State("pull served")
 	// StatePullAttempted is the state to sync on once a puller has tried
 	// pull a dataset from each remote, regardless of if the attempt was
 	// successful
@@ -28,6 +40,9 @@ var (
 	// StateConnectionAttempted is the state to sync on once an instance has attempted
 	// to connect to each other instance
 	StateConnectionAttempted = sync.State("connection to all other nodes attempted")
+	// StateDatasetRemoved is signalled by a remote each time it removes a
+	// dataset at a client's request
+	StateDatasetRemoved = sync.State("dataset removed from remote")
 )
 
 // RemoteHooks implements remote behaviour for cloud backend to store and pin
@@ -35,6 +50,40 @@ var (
 type RemoteHooks struct {
 	runenv *runtime.RunEnv
 	client sync.Client
+	// events records every hook invocation
+	events *hookEventLog
+
+	lk gosync.Mutex
+	// pushesReceived & pullsServed count completed pushes & accepted pulls
+	pushesReceived int
+	pullsServed    int
+	// removedDatasets & removedLogs record the refs removed by clients
+	removedDatasets []dsref.Ref
+	removedLogs     []dsref.Ref
+	// faults decides when hooks reject requests, injected records each
+	// rejection
+	faults   *faultInjector
+	injected []InjectedFault
+}
+
+// inject reports whether hook should fail a request, recording the fault if
+// it does
+func (r *RemoteHooks) inject(hook string, rate float64, pid profile.ID, ref dsref.Ref) error {
+	r.lk.Lock()
+	defer r.lk.Unlock()
+	if !r.faults.roll(rate) {
+		return nil
+	}
+	r.injected = append(r.injected, InjectedFault{Hook: hook, ProfileID: pid.String(), Ref: ref})
+	r.runenv.RecordMessage("%s injecting fault for %q from %q", hook, ref, pid)
+	return fmt.Errorf("%s: %w", hook, ErrInjectedFault)
+}
+
+// Injected lists the requests hooks have rejected
+func (r *RemoteHooks) Injected() []InjectedFault {
+	r.lk.Lock()
+	defer r.lk.Unlock()
+	return append([]InjectedFault{}, r.injected...)
 }
 
 // RemoteOptionsFunc creates a function to connect hooks to a remote at
@@ -47,60 +96,132 @@ func (r *RemoteHooks) RemoteOptionsFunc() lib.Option {
 			opts.DatasetPushed = r.datasetPushed
 			opts.DatasetPullPreCheck = r.datasetPullPreCheck
 			opts.DatasetPulled = r.datasetPulled
+			opts.DatasetRemovePreCheck = r.datasetRemovePreCheck
 			opts.DatasetRemoved = r.datasetRemoved
 			opts.LogPushPreCheck = r.logPushPreCheck
 			opts.LogPushFinalCheck = r.logPushFinalCheck
 			opts.LogPushed = r.logPushed
+			opts.LogRemoved = r.logRemoved
 		},
 	})
 }
 
 func (r *RemoteHooks) acceptPushPreCheck(ctx context.Context, pid profile.ID, ref dsref.Ref) error {
+	r.events.record(ctx, HookAcceptPushPreCheck, pid, ref)
 	r.runenv.RecordMessage("received push of dataset %q from %q", ref, pid)
-	return nil
+	return r.inject(HookAcceptPushPreCheck, r.faults.PushRejectRate, pid, ref)
 }
 
 func (r *RemoteHooks) acceptPushFinalCheck(ctx context.Context, pid profile.ID, ref dsref.Ref) error {
+	r.events.record(ctx, HookAcceptPushFinalCheck, pid, ref)
 	r.runenv.RecordMessage("dataset %q from %q to start sending", ref, pid)
+	if d := r.faults.PushFinalCheckDelay; d > 0 {
+		select {
+		case <-time.After(d):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
 	return nil
 }
 
 func (r *RemoteHooks) datasetPushed(ctx context.Context, pid profile.ID, ref dsref.Ref) error {
+	r.events.record(ctx, HookDatasetPushed, pid, ref)
 	r.runenv.RecordMessage("Success! Received dataset %q from %q", ref, pid)
-	r.client.MustSignalEntry(ctx, StatePushAttempted)
+	r.lk.Lock()
+	r.pushesReceived++
+	r.lk.Unlock()
+	r.client.MustSignalEntry(ctx, StatePushReceived)
 	return nil
 }
 
+// datasetPullPreCheck is stored by qri, but never called at the time of
+// writing. pull faults are injected in datasetPulled instead
 func (r *RemoteHooks) datasetPullPreCheck(ctx context.Context, pid profile.ID, ref dsref.Ref) error {
-
+	r.events.record(ctx, HookDatasetPullPreCheck, pid, ref)
 	return nil
 }
 
+// datasetPulled is called when a client asks for a dataset's DAG info, before
+// any blocks are sent, so returning an error rejects the pull
 func (r *RemoteHooks) datasetPulled(ctx context.Context, pid profile.ID, ref dsref.Ref) error {
+	r.events.record(ctx, HookDatasetPulled, pid, ref)
 	r.runenv.RecordMessage("RemoteHooks.datasetPulled: %s", ref.String())
+	if err := r.inject(HookDatasetPulled, r.faults.PullRejectRate, pid, ref); err != nil {
+		return err
+	}
+	r.lk.Lock()
+	r.pullsServed++
+	r.lk.Unlock()
+	r.client.MustSignalEntry(ctx, StatePullServed)
+	return nil
+}
 
+func (r *RemoteHooks) datasetRemovePreCheck(ctx context.Context, pid profile.ID, ref dsref.Ref) error {
+	r.events.record(ctx, HookDatasetRemovePreCheck, pid, ref)
+	r.runenv.RecordMessage("received request to remove dataset %q from %q", ref, pid)
 	return nil
 }
 
 func (r *RemoteHooks) datasetRemoved(ctx context.Context, pid profile.ID, ref dsref.Ref) error {
-	// log.Debug("RemoteHooks.datasetRemoved")
+	r.events.record(ctx, HookDatasetRemoved, pid, ref)
+	r.runenv.RecordMessage("RemoteHooks.datasetRemoved: %s", ref.String())
+	r.lk.Lock()
+	r.removedDatasets = append(r.removedDatasets, ref)
+	r.lk.Unlock()
+	r.client.MustSignalEntry(ctx, StateDatasetRemoved)
 	return nil
 }
 
 func (r *RemoteHooks) logPushPreCheck(ctx context.Context, pid profile.ID, ref dsref.Ref) error {
+	r.events.record(ctx, HookLogPushPreCheck, pid, ref)
 	r.runenv.RecordMessage("received log push: %s", ref.String())
-
 	return nil
 }
 
 func (r *RemoteHooks) logPushFinalCheck(ctx context.Context, pid profile.ID, ref dsref.Ref) error {
+	r.events.record(ctx, HookLogPushFinalCheck, pid, ref)
 	r.runenv.RecordMessage("log push final check: %s", ref.String())
-
+	if r.faults.FailLogPushFinalCheck {
+		return r.inject(HookLogPushFinalCheck, 1, pid, ref)
+	}
 	return nil
 }
 
 func (r *RemoteHooks) logPushed(ctx context.Context, pid profile.ID, ref dsref.Ref) error {
+	r.events.record(ctx, HookLogPushed, pid, ref)
 	r.runenv.RecordMessage("Success!!! RemoteHooks.logPushed: %s", ref.String())
+	return nil
+}
 
+func (r *RemoteHooks) logRemoved(ctx context.Context, pid profile.ID, ref dsref.Ref) error {
+	r.events.record(ctx, HookLogRemoved, pid, ref)
+	r.runenv.RecordMessage("RemoteHooks.logRemoved: %s", ref.String())
+	r.lk.Lock()
+	r.removedLogs = append(r.removedLogs, ref)
+	r.lk.Unlock()
 	return nil
 }
+
+// PushesReceived is the number of dataset pushes this remote has completed
+func (r *RemoteHooks) PushesReceived() int {
+	r.lk.Lock()
+	defer r.lk.Unlock()
+	return r.pushesReceived
+}
+
+// PullsServed is the number of pulls this remote has accepted
+func (r *RemoteHooks) PullsServed() int {
+	r.lk.Lock()
+	defer r.lk.Unlock()
+	return r.pullsServed
+}
+
+// Removed lists the datasets & logs clients have removed from this remote
+func (r *RemoteHooks) Removed() (datasets, logs []dsref.Ref) {
+	r.lk.Lock()
+	defer r.lk.Unlock()
+	datasets = append([]dsref.Ref{}, r.removedDatasets...)
+	logs = append([]dsref.Ref{}, r.removedLogs...)
+	return datasets, logs
+}